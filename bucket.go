@@ -0,0 +1,315 @@
+package lokaldb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ListBuckets gets the names of the top level buckets in the local database in ascending order. Internal buckets are not listed.
+func (db *LokalDB) ListBuckets() ([]string, error) {
+	return db.ListBucketsCtx(context.Background())
+}
+
+// ListBucketsCtx is ListBuckets with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) ListBucketsCtx(ctx context.Context) (names []string, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		names, err = tx.ListBuckets()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// BucketExists checks if the bucket exists in the local database
+func (db *LokalDB) BucketExists(bucket string) (bool, error) {
+	return db.BucketExistsCtx(context.Background(), bucket)
+}
+
+// BucketExistsCtx is BucketExists with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) BucketExistsCtx(ctx context.Context, bucket string) (exists bool, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		exists, err = tx.BucketExists(bucket)
+		return
+	})
+	return
+}
+
+// DropBucket removes the bucket with all its records, its internal bucket and the buckets under it.
+// The secondary indexes defined on them are removed too.
+func (db *LokalDB) DropBucket(bucket string) error {
+	return db.DropBucketCtx(context.Background(), bucket)
+}
+
+// DropBucketCtx is DropBucket with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) DropBucketCtx(ctx context.Context, bucket string) error {
+
+	err := db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.DropBucket(bucket)
+	})
+	if err != nil {
+		return err
+	}
+
+	db.moveIndexes(bucket, ``)
+
+	return nil
+}
+
+// PurgeBucket removes all records of the bucket but keeps the bucket and its configuration.
+// Records stored afterwards continue the indexes of the purged records.
+func (db *LokalDB) PurgeBucket(bucket string) error {
+	return db.PurgeBucketCtx(context.Background(), bucket)
+}
+
+// PurgeBucketCtx is PurgeBucket with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) PurgeBucketCtx(ctx context.Context, bucket string) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.PurgeBucket(bucket)
+	})
+}
+
+// RenameBucket renames the bucket together with its internal bucket. The new name must not be in use.
+// The secondary indexes defined on the bucket and the buckets under it move with them.
+// A bucket with records reserved by a lease that has not expired cannot be renamed, since Ack and Nack
+// find the bucket of a lease by its name. They return ErrLeaseNotFound for the leases that expired before the rename.
+func (db *LokalDB) RenameBucket(bucket string, newName string) error {
+	return db.RenameBucketCtx(context.Background(), bucket, newName)
+}
+
+// RenameBucketCtx is RenameBucket with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) RenameBucketCtx(ctx context.Context, bucket string, newName string) error {
+
+	err := db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.RenameBucket(bucket, newName)
+	})
+	if err != nil {
+		return err
+	}
+
+	if newName != bucket {
+		db.moveIndexes(bucket, newName)
+	}
+
+	return nil
+}
+
+// ListBuckets gets the names of the top level buckets in ascending order. Internal buckets are not listed.
+func (tx *Tx) ListBuckets() ([]string, error) {
+	return children(tx.tx), nil
+}
+
+// BucketExists checks if the bucket exists
+func (tx *Tx) BucketExists(bucket string) (bool, error) {
+
+	_, _, err := tx.bucket(bucket)
+	if errors.Is(err, ErrBucketDoesNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// DropBucket removes the bucket with all its records, its internal bucket and the buckets under it.
+// The secondary indexes defined on them are only removed by LokalDB.DropBucket, once the transaction is committed.
+func (tx *Tx) DropBucket(bucket string) error {
+
+	var (
+		err  error
+		c    container
+		name []byte
+	)
+
+	if _, _, err = tx.writable(bucket); err != nil {
+		return err
+	}
+
+	if c, name, err = tx.parent(bucket, false); err != nil {
+		return err
+	}
+
+	if err = c.DeleteBucket(name); err != nil {
+		return err
+	}
+
+	if err = c.DeleteBucket(inname(name)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// PurgeBucket removes all records of the bucket but keeps the bucket and its configuration
+func (tx *Tx) PurgeBucket(bucket string) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return err
+	}
+
+	if err = purge(tx.ctx, b, inb); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RenameBucket renames the bucket together with its internal bucket and the buckets under it.
+// The new name can be a path on another level. It must not be in use. The secondary indexes defined
+// on them only move with LokalDB.RenameBucket, once the transaction is committed.
+// It returns ErrBucketLeased if a record of the buckets is reserved by a lease that has not expired.
+func (tx *Tx) RenameBucket(bucket string, newName string) error {
+
+	var (
+		err      error
+		b, inb   *bolt.Bucket
+		nb, ninb *bolt.Bucket
+		c        container
+		name     []byte
+	)
+
+	if b, inb, err = tx.writable(bucket); err != nil {
+		return err
+	}
+
+	if newName == bucket {
+		return nil
+	}
+
+	// A bucket cannot be moved under itself
+	if strings.HasPrefix(newName, bucket+PathSeparator) {
+		return ErrInvalidPath
+	}
+
+	// Lease identifiers keep the name of the bucket, so Ack and Nack would not find the leases after the move
+	now := tx.now()
+	if inb != nil && reserving(inb, now) {
+		return ErrBucketLeased
+	}
+	err = tx.tree(bucket, func(_ string, _, cinb *bolt.Bucket) error {
+		if cinb != nil && reserving(cinb, now) {
+			return ErrBucketLeased
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if exists, _ := tx.BucketExists(newName); exists {
+		return ErrBucketExists
+	}
+
+	if c, name, err = tx.parent(newName, true); err != nil {
+		return err
+	}
+
+	if nb, err = c.CreateBucket(name); err != nil {
+		return err
+	}
+	if err = copyBucket(nb, b); err != nil {
+		return err
+	}
+
+	if inb != nil {
+		if ninb, err = c.CreateBucketIfNotExists(inname(name)); err != nil {
+			return err
+		}
+		if err = copyBucket(ninb, inb); err != nil {
+			return err
+		}
+	}
+
+	return tx.DropBucket(bucket)
+}
+
+// Remove all records of a bucket and reset its record count. The last index is kept
+// so that the indexes of new records keep increasing.
+func purge(ctx context.Context, b, inb *bolt.Bucket) error {
+
+	var (
+		err    error
+		lstidx int
+	)
+
+	if err = clearBucket(ctx, b, nil); err != nil {
+		return err
+	}
+
+	// Keep the bookkeeping keys of the internal bucket
+	if err = clearBucket(ctx, inb, func(k []byte) bool {
+		return bytes.Equal(k, recFirstIdxKey) || bytes.Equal(k, recLastIdxKey)
+	}); err != nil {
+		return err
+	}
+
+	// Revisions, envelopes, index entries, chunks, leases, due times and expiry times start over with the records
+	for _, name := range [][]byte{recRevBucket, recEnvBucket, recIdxBucket, recChunkBucket, recLeaseBucket, recDueBucket, recExpBucket} {
+		if err = inb.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+	}
+
+	lstidx = getint(inb, recLastIdxKey)
+	if err = putint(inb, recFirstIdxKey, lstidx+1); err != nil {
+		return err
+	}
+
+	return putint(inb, recCntKey, 0)
+}
+
+// Delete the key-values of a bucket except the keys to keep until the context is done. Nested buckets are not deleted.
+func clearBucket(ctx context.Context, b *bolt.Bucket, keep func(k []byte) bool) error {
+
+	c := b.Cursor()
+	k, v := c.First()
+	for k != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if v == nil || (keep != nil && keep(k)) {
+			k, v = c.Next()
+			continue
+		}
+
+		// The cursor is positioned again after the deleted key
+		k = bytes.Clone(k)
+		if err := c.Delete(); err != nil {
+			return err
+		}
+		k, v = c.Seek(k)
+	}
+
+	return nil
+}
+
+// Copy the key-values and nested buckets of a bucket to another bucket
+func copyBucket(dst, src *bolt.Bucket) error {
+
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		nb, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+
+		return copyBucket(nb, src.Bucket(k))
+	})
+}
@@ -0,0 +1,143 @@
+package lokaldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBucketManagement(t *testing.T) {
+	var (
+		err    error
+		db     *LokalDB
+		names  []string
+		exists bool
+		cnt    int
+		b      []byte
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for _, bucket := range []string{`outbound`, `inflight`, `audit`} {
+		for i := 0; i < 5; i++ {
+			if err = db.Store(bucket, fmt.Sprintf("m%02d", i), []byte(bucket)); err != nil {
+				t.Fatalf("store: %s", err)
+			}
+		}
+	}
+
+	if names, err = db.ListBuckets(); err != nil {
+		t.Fatalf("list buckets: %s", err)
+	}
+	if got := strings.Join(names, `,`); got != `audit,inflight,outbound` {
+		t.Fatalf("list buckets: got %s", got)
+	}
+
+	if exists, _ = db.BucketExists(`audit`); !exists {
+		t.Fatal(`bucket exists: audit not found`)
+	}
+	if exists, _ = db.BucketExists(`missing`); exists {
+		t.Fatal(`bucket exists: missing found`)
+	}
+
+	// Drop
+	if err = db.DropBucket(`audit`); err != nil {
+		t.Fatalf("drop bucket: %s", err)
+	}
+	if err = db.DropBucket(`audit`); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("drop missing bucket: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+	if err = db.Store(`audit`, `m00`, []byte(`new`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if cnt, _ = db.Count(`audit`); cnt != 1 {
+		t.Fatalf("count after drop: got %d, want 1", cnt)
+	}
+
+	// Purge keeps the bucket and continues its indexes
+	if err = db.PurgeBucket(`inflight`); err != nil {
+		t.Fatalf("purge bucket: %s", err)
+	}
+	if cnt, err = db.Count(`inflight`); err != nil || cnt != 0 {
+		t.Fatalf("count after purge: got %d, %v", cnt, err)
+	}
+	if err = db.Store(`inflight`, `m10`, []byte(`new`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	chunk, err := db.FetchChunkDown(`inflight`, 0, 0)
+	if err != nil || keysOf(chunk) != `m10 ` {
+		t.Fatalf("fetch after purge: got %s, %v", keysOf(chunk), err)
+	}
+
+	// Rename
+	if err = db.RenameBucket(`outbound`, `inflight`); !errors.Is(err, ErrBucketExists) {
+		t.Fatalf("rename to existing: got %v, want %v", err, ErrBucketExists)
+	}
+	if err = db.RenameBucket(`outbound`, `spool`); err != nil {
+		t.Fatalf("rename: %s", err)
+	}
+	if exists, _ = db.BucketExists(`outbound`); exists {
+		t.Fatal(`rename: old bucket still exists`)
+	}
+	if cnt, _ = db.Count(`spool`); cnt != 5 {
+		t.Fatalf("count after rename: got %d, want 5", cnt)
+	}
+	if b, err = db.SliceDown(`spool`); err != nil || string(b) != `outbound` {
+		t.Fatalf("slice down after rename: got %s, %v", b, err)
+	}
+	if names, _ = db.ListBuckets(); strings.Join(names, `,`) != `audit,inflight,spool` {
+		t.Fatalf("list buckets after rename: got %v", names)
+	}
+}
+
+func TestBucketContext(t *testing.T) {
+	var (
+		err    error
+		db     *LokalDB
+		exists bool
+		cnt    int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.Store(`outbound`, `m01`, []byte(`1`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+
+	// A context done before the call changes nothing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = db.ListBucketsCtx(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("list buckets: got %v, want %v", err, context.Canceled)
+	}
+	if _, err = db.BucketExistsCtx(ctx, `outbound`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("bucket exists: got %v, want %v", err, context.Canceled)
+	}
+	if err = db.PurgeBucketCtx(ctx, `outbound`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("purge bucket: got %v, want %v", err, context.Canceled)
+	}
+	if err = db.RenameBucketCtx(ctx, `outbound`, `archive`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("rename bucket: got %v, want %v", err, context.Canceled)
+	}
+	if err = db.DropBucketCtx(ctx, `outbound`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("drop bucket: got %v, want %v", err, context.Canceled)
+	}
+
+	if exists, err = db.BucketExistsCtx(context.Background(), `outbound`); err != nil || !exists {
+		t.Fatalf("bucket exists after cancel: got %v %v, want true", exists, err)
+	}
+	if cnt, err = db.Count(`outbound`); err != nil || cnt != 1 {
+		t.Fatalf("count after cancel: got %d %v, want 1", cnt, err)
+	}
+}
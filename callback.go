@@ -0,0 +1,93 @@
+package lokaldb
+
+import (
+	"context"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FetchFunc calls fn with the value of the record with the provided key inside a read-only transaction.
+// The value is not copied: it is only valid until fn returns and must not be modified.
+// If the record does not exist, fn is not called and ErrKeyNotFound is returned. An error of fn is returned as is.
+func (db *LokalDB) FetchFunc(bucket string, key string, fn func(value []byte) error) error {
+	return db.FetchFuncCtx(context.Background(), bucket, key, fn)
+}
+
+// FetchFuncCtx is FetchFunc with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchFuncCtx(ctx context.Context, bucket string, key string, fn func(value []byte) error) error {
+	return db.ViewCtx(ctx, func(tx *Tx) error {
+		return tx.FetchFunc(bucket, key, fn)
+	})
+}
+
+// ForEachChunk calls fn with up to max records of the bucket in the direction inside a read-only transaction.
+// A max of zero calls it with all the records. The values are not copied: they are only valid until fn
+// returns and must not be modified. Iteration stops at the first error of fn, which is returned as is.
+// A direction other than Down or Up returns ErrInvalidDirection.
+func (db *LokalDB) ForEachChunk(bucket string, max int, direction Direction, fn func(kv ChunkData) error) error {
+	return db.ForEachChunkCtx(context.Background(), bucket, max, direction, fn)
+}
+
+// ForEachChunkCtx is ForEachChunk with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) ForEachChunkCtx(ctx context.Context, bucket string, max int, direction Direction, fn func(kv ChunkData) error) error {
+	return db.ViewCtx(ctx, func(tx *Tx) error {
+		return tx.ForEachChunk(bucket, max, direction, fn)
+	})
+}
+
+// FetchFunc calls fn with the value of the record with the provided key. The value is only valid until fn returns.
+func (tx *Tx) FetchFunc(bucket string, key string, fn func(value []byte) error) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		data   []byte
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil {
+		return err
+	}
+
+	if data, _ = view(b, inb, []byte(key)); data == nil || expired(inb, []byte(key), tx.now()) {
+		return ErrKeyNotFound
+	}
+
+	return fn(data)
+}
+
+// ForEachChunk calls fn with up to max records of the bucket in the direction. The values are only valid until fn returns.
+func (tx *Tx) ForEachChunk(bucket string, max int, direction Direction, fn func(kv ChunkData) error) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		n      int
+	)
+
+	if direction != Down && direction != Up {
+		return ErrInvalidDirection
+	}
+
+	if b, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return err
+	}
+
+	live(inb, -1, direction == Down, tx.now(), func(idx int, keyb []byte) bool {
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+
+		data, _ := view(b, inb, keyb)
+		err = fn(ChunkData{
+			Key:      string(keyb),
+			Value:    data,
+			Seq:      uint64(idx),
+			Envelope: envelope(inb, keyb),
+		})
+
+		n++
+		return err == nil && (max == 0 || n < max)
+	})
+
+	return err
+}
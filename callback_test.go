@@ -0,0 +1,90 @@
+package lokaldb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValueCopies(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		data  []byte
+		chunk []ChunkData
+		keys  []string
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 5; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("k%02d", i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	// Writing to the memory of the database would crash, so returned values must be copies
+	if data, err = db.Fetch(`default`, `k01`); err != nil {
+		t.Fatalf("fetch: %s", err)
+	}
+	data[0] = 'X'
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil {
+		t.Fatalf("fetch chunk down: %s", err)
+	}
+	for _, kv := range chunk {
+		kv.Value[0] = 'X'
+	}
+	if data, _ = db.Fetch(`default`, `k01`); string(data) != `value-1` {
+		t.Fatalf("fetch after modifying copies: got %q", data)
+	}
+
+	// Callbacks get the values inside the transaction
+	err = db.FetchFunc(`default`, `k02`, func(value []byte) error {
+		if string(value) != `value-2` {
+			return fmt.Errorf("fetch func: got %q", value)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.FetchFunc(`default`, `missing`, func([]byte) error { return nil }); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("fetch func missing key: got %v, want %v", err, ErrKeyNotFound)
+	}
+
+	err = db.ForEachChunk(`default`, 3, Up, func(kv ChunkData) error {
+		keys = append(keys, kv.Key)
+		return nil
+	})
+	if err != nil || strings.Join(keys, ` `) != `k05 k04 k03` {
+		t.Fatalf("for each chunk up: got %v, %v", keys, err)
+	}
+
+	errStop := errors.New(`stop`)
+	keys = keys[:0]
+	err = db.ForEachChunk(`default`, 0, Down, func(kv ChunkData) error {
+		keys = append(keys, kv.Key)
+		if kv.Key == `k02` {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || strings.Join(keys, ` `) != `k01 k02` {
+		t.Fatalf("for each chunk down: got %v, %v", keys, err)
+	}
+
+	keys = keys[:0]
+	err = db.ForEachChunk(`default`, 0, Direction(7), func(kv ChunkData) error {
+		keys = append(keys, kv.Key)
+		return nil
+	})
+	if !errors.Is(err, ErrInvalidDirection) || len(keys) != 0 {
+		t.Fatalf("for each chunk invalid direction: got %v, %v, want %v", keys, err, ErrInvalidDirection)
+	}
+}
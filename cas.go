@@ -0,0 +1,211 @@
+package lokaldb
+
+import (
+	"context"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Name of the bucket inside the internal bucket that keeps the revision of each key
+var recRevBucket []byte = []byte(`qsR6RZ24lPoQj3oPUlie`)
+
+// StoreIfAbsent inserts data in the bucket only if the key does not exist yet. Otherwise it returns ErrConflict.
+func (db *LokalDB) StoreIfAbsent(bucket string, key string, data []byte) error {
+	return db.StoreIfAbsentCtx(context.Background(), bucket, key, data)
+}
+
+// StoreIfAbsentCtx is StoreIfAbsent with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreIfAbsentCtx(ctx context.Context, bucket string, key string, data []byte) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.StoreIfAbsent(bucket, key, data)
+	})
+}
+
+// Replace updates the record with the key only if it exists. Otherwise it returns ErrConflict.
+// The record keeps its position in the queue.
+func (db *LokalDB) Replace(bucket string, key string, data []byte) error {
+	return db.ReplaceCtx(context.Background(), bucket, key, data)
+}
+
+// ReplaceCtx is Replace with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) ReplaceCtx(ctx context.Context, bucket string, key string, data []byte) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.Replace(bucket, key, data)
+	})
+}
+
+// CompareAndSwap stores data with the key only if the current revision of the key is the expected revision,
+// and returns the new revision. An expected revision of zero means that the key must not exist.
+// If the revision does not match, it returns ErrConflict.
+func (db *LokalDB) CompareAndSwap(bucket string, key string, expectedRevision uint64, newData []byte) (uint64, error) {
+	return db.CompareAndSwapCtx(context.Background(), bucket, key, expectedRevision, newData)
+}
+
+// CompareAndSwapCtx is CompareAndSwap with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) CompareAndSwapCtx(ctx context.Context, bucket string, key string, expectedRevision uint64, newData []byte) (rev uint64, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		rev, err = tx.CompareAndSwap(bucket, key, expectedRevision, newData)
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// Revision gets the current revision of the key. The revision increases every time the key is stored.
+// Revisions are never reused in the bucket, even by a key that was removed and stored again. It is zero if the key does not exist.
+func (db *LokalDB) Revision(bucket string, key string) (uint64, error) {
+	return db.RevisionCtx(context.Background(), bucket, key)
+}
+
+// RevisionCtx is Revision with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) RevisionCtx(ctx context.Context, bucket string, key string) (rev uint64, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		rev, err = tx.Revision(bucket, key)
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// StoreIfAbsent inserts data in the bucket only if the key does not exist yet. Otherwise it returns ErrConflict.
+func (tx *Tx) StoreIfAbsent(bucket string, key string, data []byte) error {
+	_, err := tx.CompareAndSwap(bucket, key, 0, data)
+	return err
+}
+
+// Replace updates the record with the key only if it exists. Otherwise it returns ErrConflict.
+func (tx *Tx) Replace(bucket string, key string, data []byte) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if b, inb, err = tx.writable(bucket); err != nil {
+		return err
+	}
+
+	if inb == nil || b.Get([]byte(key)) == nil {
+		return ErrConflict
+	}
+
+	return put(b, inb, []byte(key), data, nil, replacePolicy(inb), tx.indexes(bucket), tx.now())
+}
+
+// CompareAndSwap stores data with the key only if the current revision of the key is the expected revision,
+// and returns the new revision.
+func (tx *Tx) CompareAndSwap(bucket string, key string, expectedRevision uint64, newData []byte) (uint64, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		keyb   = []byte(key)
+	)
+
+	// Only a store of a new key can create the bucket
+	if expectedRevision == 0 {
+		b, inb, err = tx.create(bucket)
+	} else {
+		b, inb, err = tx.writable(bucket)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if inb == nil || revision(b, inb, keyb) != expectedRevision {
+		return 0, ErrConflict
+	}
+
+	if err = put(b, inb, keyb, newData, nil, replacePolicy(inb), tx.indexes(bucket), tx.now()); err != nil {
+		return 0, err
+	}
+
+	return revision(b, inb, keyb), nil
+}
+
+// Revision gets the current revision of the key. It is zero if the key does not exist.
+func (tx *Tx) Revision(bucket string, key string) (uint64, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return 0, err
+	}
+
+	return revision(b, inb, []byte(key)), nil
+}
+
+// Get the overwrite policy of a conditional write. The condition was already checked,
+// so the write is never rejected, but the record is still moved if the bucket says so.
+func replacePolicy(inb *bolt.Bucket) OverwritePolicy {
+
+	if p := overwritePolicy(inb, BucketPolicy); p != RejectOverwrite {
+		return p
+	}
+
+	return KeepPosition
+}
+
+// Get the revision of a key. Records stored by earlier versions have no revision yet and are at revision 1.
+func revision(b, inb *bolt.Bucket, key []byte) uint64 {
+
+	if b.Get(key) == nil {
+		return 0
+	}
+
+	if rb := inb.Bucket(recRevBucket); rb != nil {
+		if rev, _ := strconv.ParseUint(string(rb.Get(key)), 10, 64); rev > 0 {
+			return rev
+		}
+	}
+
+	return 1
+}
+
+// Give a new revision to a key that has just been stored. Revisions come from the sequence of the internal
+// bucket, which is kept when the bucket is purged, so a key removed and stored again never gets an old revision back.
+func bumpRevision(b, inb *bolt.Bucket, key []byte, existed bool) error {
+
+	var cur uint64
+	if existed {
+		cur = revision(b, inb, key)
+	}
+
+	rev, err := inb.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	// Revisions of records stored by earlier versions were counted per key
+	if rev <= cur {
+		rev = cur + 1
+		if err = inb.SetSequence(rev); err != nil {
+			return err
+		}
+	}
+
+	rb, err := inb.CreateBucketIfNotExists(recRevBucket)
+	if err != nil {
+		return err
+	}
+
+	return rb.Put(key, []byte(strconv.FormatUint(rev, 10)))
+}
+
+// Forget the revision of a removed key
+func dropRevision(inb *bolt.Bucket, key []byte) error {
+
+	if rb := inb.Bucket(recRevBucket); rb != nil {
+		return rb.Delete(key)
+	}
+
+	return nil
+}
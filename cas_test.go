@@ -0,0 +1,104 @@
+package lokaldb
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestConditionalWrites(t *testing.T) {
+	var (
+		err  error
+		db   *LokalDB
+		rev  uint64
+		cnt  int
+		data []byte
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	// Only the first producer stores the key
+	if err = db.StoreIfAbsent(`default`, `order-a`, []byte(`first`)); err != nil {
+		t.Fatalf("store if absent: %s", err)
+	}
+	if err = db.StoreIfAbsent(`default`, `order-a`, []byte(`second`)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("store if absent: got %v, want %v", err, ErrConflict)
+	}
+	if data, _ = db.Fetch(`default`, `order-a`); string(data) != `first` {
+		t.Fatalf("fetch: got %q, want %q", data, `first`)
+	}
+
+	if err = db.Replace(`default`, `order-b`, []byte(`data`)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("replace missing key: got %v, want %v", err, ErrConflict)
+	}
+	if err = db.Replace(`default`, `order-a`, []byte(`replaced`)); err != nil {
+		t.Fatalf("replace: %s", err)
+	}
+
+	// Stored twice so far
+	if rev, err = db.Revision(`default`, `order-a`); err != nil || rev != 2 {
+		t.Fatalf("revision: got %d, %v, want 2", rev, err)
+	}
+
+	if _, err = db.CompareAndSwap(`default`, `order-a`, 1, []byte(`stale`)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("compare and swap stale: got %v, want %v", err, ErrConflict)
+	}
+	if rev, err = db.CompareAndSwap(`default`, `order-a`, 2, []byte(`swapped`)); err != nil || rev != 3 {
+		t.Fatalf("compare and swap: got %d, %v, want 3", rev, err)
+	}
+	if data, _ = db.Fetch(`default`, `order-a`); string(data) != `swapped` {
+		t.Fatalf("fetch: got %q, want %q", data, `swapped`)
+	}
+
+	// An expected revision of zero requires a missing key
+	if _, err = db.CompareAndSwap(`default`, `order-a`, 0, []byte(`data`)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("compare and swap existing: got %v, want %v", err, ErrConflict)
+	}
+	// Revisions come from a sequence of the bucket
+	if rev, err = db.CompareAndSwap(`default`, `order-b`, 0, []byte(`data`)); err != nil || rev != 4 {
+		t.Fatalf("compare and swap new: got %d, %v, want 4", rev, err)
+	}
+
+	// Plain stores bump the revision too
+	if err = db.Store(`default`, `order-b`, []byte(`data`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if rev, _ = db.Revision(`default`, `order-b`); rev != 5 {
+		t.Fatalf("revision after store: got %d, want 5", rev)
+	}
+	if err = db.Delete(`default`, `order-b`); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if rev, _ = db.Revision(`default`, `order-b`); rev != 0 {
+		t.Fatalf("revision after delete: got %d, want 0", rev)
+	}
+
+	// A key stored again after it was removed never gets an old revision back
+	if rev, err = db.CompareAndSwap(`default`, `order-b`, 0, []byte(`recreated`)); err != nil || rev != 6 {
+		t.Fatalf("compare and swap recreated: got %d, %v, want 6", rev, err)
+	}
+	if _, err = db.CompareAndSwap(`default`, `order-b`, 4, []byte(`stale`)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("compare and swap stale after recreate: got %v, want %v", err, ErrConflict)
+	}
+	if data, _ = db.Fetch(`default`, `order-b`); string(data) != `recreated` {
+		t.Fatalf("fetch recreated: got %q, want %q", data, `recreated`)
+	}
+
+	if err = db.PurgeBucket(`default`); err != nil {
+		t.Fatalf("purge: %s", err)
+	}
+	if err = db.StoreIfAbsent(`default`, `order-a`, []byte(`data`)); err != nil {
+		t.Fatalf("store if absent after purge: %s", err)
+	}
+	if rev, _ = db.Revision(`default`, `order-a`); rev != 7 {
+		t.Fatalf("revision after purge: got %d, want 7", rev)
+	}
+
+	if cnt, _ = db.Count(`default`); cnt != 1 {
+		t.Fatalf("count: got %d, want 1", cnt)
+	}
+}
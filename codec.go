@@ -0,0 +1,82 @@
+package lokaldb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec encodes values of a typed queue to bytes and decodes them back
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes values with encoding/json
+type JSONCodec[T any] struct{}
+
+// Encode the value to JSON
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode the value from JSON
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec encodes values with encoding/gob
+type GobCodec[T any] struct{}
+
+// Encode the value to gob
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode the value from gob
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// DecodeError is returned when a stored value cannot be decoded by the codec of a queue
+type DecodeError struct {
+	Bucket string
+	Key    string
+	Err    error
+}
+
+// Error message of the decode error
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("lokaldb: cannot decode value of key %q in bucket %q: %s", e.Key, e.Bucket, e.Err)
+}
+
+// Unwrap returns the error of the codec
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError is returned when a value cannot be encoded by the codec of a queue
+type EncodeError struct {
+	Bucket string
+	Key    string
+	Err    error
+}
+
+// Error message of the encode error
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("lokaldb: cannot encode value of key %q in bucket %q: %s", e.Key, e.Bucket, e.Err)
+}
+
+// Unwrap returns the error of the codec
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,330 @@
+package lokaldb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Headers added to the envelope of a record moved to a dead-letter bucket
+const (
+	HeaderDeadLetterReason = `Dead-Letter-Reason` // Why the last delivery of the record failed
+	HeaderDeadLetterSource = `Dead-Letter-Source` // Bucket the record was moved from
+	HeaderDeadLetterKey    = `Dead-Letter-Key`    // Key of the record in the bucket it was moved from
+)
+
+// Failure reasons of records that are released without one
+const (
+	ReasonReleased     = `released`
+	ReasonLeaseExpired = `lease expired`
+)
+
+// Configuration keys of the dead-letter policy
+var (
+	confDeadLetterKey  []byte = []byte(`deadletter`)
+	confMaxReleasesKey []byte = []byte(`maxreleases`)
+)
+
+// SetDeadLetter sets the dead-letter policy of the bucket. A reserved record that is released more than
+// maxReleases times, by Nack or by the expiry of its lease, is moved to the dead-letter bucket with the
+// reason of its last failure in the same transaction. The bucket is created if it does not exist.
+// Dead letters are never overwritten: a record whose key is already in the dead-letter bucket is stored
+// with a new key, and its own key is kept in the Dead-Letter-Key header.
+// An empty dead-letter bucket removes the policy.
+//
+//	err = db.SetDeadLetter(`outbound`, `outbound-dlq`, 5)
+func (db *LokalDB) SetDeadLetter(bucket string, dlq string, maxReleases int) error {
+	return db.SetDeadLetterCtx(context.Background(), bucket, dlq, maxReleases)
+}
+
+// SetDeadLetterCtx is SetDeadLetter with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) SetDeadLetterCtx(ctx context.Context, bucket string, dlq string, maxReleases int) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.SetDeadLetter(bucket, dlq, maxReleases)
+	})
+}
+
+// DeadLetter gets the dead-letter bucket of the bucket and the number of releases allowed before records
+// are moved to it. The dead-letter bucket is empty if the bucket has no dead-letter policy.
+func (db *LokalDB) DeadLetter(bucket string) (string, int, error) {
+	return db.DeadLetterCtx(context.Background(), bucket)
+}
+
+// DeadLetterCtx is DeadLetter with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) DeadLetterCtx(ctx context.Context, bucket string) (dlq string, maxReleases int, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		dlq, maxReleases, err = tx.DeadLetter(bucket)
+		return
+	})
+	if err != nil {
+		return ``, 0, err
+	}
+	return
+}
+
+// NackWithReason is Nack with the reason of the failure. The reason is kept in the Dead-Letter-Reason
+// header of the records that are moved to the dead-letter bucket.
+func (db *LokalDB) NackWithReason(leaseID string, reason string, keys ...string) error {
+	return db.NackWithReasonCtx(context.Background(), leaseID, reason, keys...)
+}
+
+// NackWithReasonCtx is NackWithReason with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) NackWithReasonCtx(ctx context.Context, leaseID string, reason string, keys ...string) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.NackWithReason(leaseID, reason, keys...)
+	})
+}
+
+// Redrive moves up to n records from the top of the dead-letter bucket to the bottom of the target bucket,
+// once the issue that made them fail is fixed. Their attempts are reset and the dead-letter headers are removed.
+// A maximum of zero moves all of them. It returns the number of records moved.
+// Records whose keys are in the target are left in the dead-letter bucket, since the target holds a newer
+// state of them. Of several dead letters of the same key, only the first one is moved.
+// The target cannot be the dead-letter bucket itself.
+func (db *LokalDB) Redrive(dlq string, target string, n int) (int, error) {
+	return db.RedriveCtx(context.Background(), dlq, target, n)
+}
+
+// RedriveCtx is Redrive with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) RedriveCtx(ctx context.Context, dlq string, target string, n int) (moved int, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		moved, err = tx.Redrive(dlq, target, n)
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// SetDeadLetter sets the dead-letter policy of the bucket. The bucket is created if it does not exist.
+func (tx *Tx) SetDeadLetter(bucket string, dlq string, maxReleases int) error {
+
+	var (
+		err  error
+		inb  *bolt.Bucket
+		conf *bolt.Bucket
+	)
+
+	if maxReleases < 0 || (dlq != `` && dlq == bucket) {
+		return ErrInvalidPolicy
+	}
+
+	if _, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	if conf, err = inb.CreateBucketIfNotExists(recConfBucket); err != nil {
+		return err
+	}
+
+	if dlq == `` {
+		if err = conf.Delete(confDeadLetterKey); err != nil {
+			return err
+		}
+		return conf.Delete(confMaxReleasesKey)
+	}
+
+	if err = conf.Put(confDeadLetterKey, []byte(dlq)); err != nil {
+		return err
+	}
+
+	return conf.Put(confMaxReleasesKey, []byte(strconv.Itoa(maxReleases)))
+}
+
+// DeadLetter gets the dead-letter bucket of the bucket and the number of releases allowed before records are moved to it
+func (tx *Tx) DeadLetter(bucket string) (string, int, error) {
+
+	var (
+		err error
+		inb *bolt.Bucket
+	)
+
+	if _, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return ``, 0, err
+	}
+
+	dlq, maxReleases := deadLetter(inb)
+
+	return dlq, maxReleases, nil
+}
+
+// NackWithReason releases the records of the lease with the keys, moving the ones released too many times
+// to the dead-letter bucket with the reason
+func (tx *Tx) NackWithReason(leaseID string, reason string, keys ...string) error {
+
+	b, inb, held, err := tx.leased(leaseID, keys)
+	if err != nil {
+		return err
+	}
+
+	// The lease was found, so its identifier has a bucket
+	bucket, _ := leaseBucket(leaseID)
+
+	if reason == `` {
+		reason = ReasonReleased
+	}
+
+	for _, keyb := range held {
+		if exhausted(inb, keyb) {
+			err = tx.deadLetter(bucket, b, inb, keyb, reason)
+		} else {
+			err = release(inb, keyb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Redrive moves up to n records from the top of the dead-letter bucket to the bottom of the target bucket,
+// skipping the records whose keys are in the target
+func (tx *Tx) Redrive(dlq string, target string, n int) (int, error) {
+
+	var (
+		err      error
+		b, inb   *bolt.Bucket
+		tb, tinb *bolt.Bucket
+		chunk    []ChunkData
+		keys     [][]byte
+		moving   = make(map[string]bool)
+	)
+
+	if n < 0 {
+		return 0, ErrInvalidLimit
+	}
+
+	// Records would be removed right after being stored again
+	if dlq == target {
+		return 0, ErrInvalidPolicy
+	}
+
+	if b, inb, err = tx.writable(dlq); err != nil || inb == nil {
+		return 0, err
+	}
+
+	if tb, _, err = tx.bucket(target); err != nil && !errors.Is(err, ErrBucketDoesNotExist) {
+		return 0, err
+	}
+
+	walk(inb, -1, true, func(idx int, keyb []byte) bool {
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+		// The value is not read, so that the chunks of a big value are moved as they are
+		kv := ChunkData{Key: string(keyb), Seq: uint64(idx), Envelope: envelope(inb, keyb)}
+		kv.Key = sourceKey(kv)
+
+		// The target has a newer state of the record, or another dead letter of it is moved first
+		if (tb != nil && tb.Get([]byte(kv.Key)) != nil) || moving[kv.Key] {
+			return true
+		}
+		moving[kv.Key] = true
+		chunk = append(chunk, kv)
+		keys = append(keys, keyb)
+		return n == 0 || len(chunk) < n
+	})
+	if err != nil || len(chunk) == 0 {
+		return 0, err
+	}
+
+	if tb, tinb, err = tx.create(target); err != nil {
+		return 0, err
+	}
+
+	ix := tx.indexes(target)
+	for i, kv := range chunk {
+		delete(kv.Headers, HeaderDeadLetterReason)
+		delete(kv.Headers, HeaderDeadLetterSource)
+		delete(kv.Headers, HeaderDeadLetterKey)
+		kv.Attempts = 0
+		if err = putFrom(tb, tinb, []byte(kv.Key), b, inb, keys[i], &kv.Envelope, RejectOverwrite, ix, tx.now()); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = remove(b, inb, keys...); err != nil {
+		return 0, err
+	}
+
+	return len(chunk), nil
+}
+
+// Move a record to the dead-letter bucket of its bucket with the reason of its failure
+func (tx *Tx) deadLetter(bucket string, b, inb *bolt.Bucket, key []byte, reason string) error {
+
+	var (
+		err       error
+		dlb, dinb *bolt.Bucket
+	)
+
+	dlq, _ := deadLetter(inb)
+	if dlb, dinb, err = tx.create(dlq); err != nil {
+		return err
+	}
+
+	env := envelope(inb, key)
+	if env.Headers == nil {
+		env.Headers = make(map[string][]string)
+	}
+	env.Headers[HeaderDeadLetterReason] = []string{reason}
+	env.Headers[HeaderDeadLetterSource] = []string{bucket}
+	env.Headers[HeaderDeadLetterKey] = []string{string(key)}
+
+	// Another dead letter with the same key is kept
+	dkey := key
+	for dlb.Get(dkey) != nil || dlb.Bucket(dkey) != nil {
+		seq, err := dlb.NextSequence()
+		if err != nil {
+			return err
+		}
+		dkey = []byte(string(key) + `.` + strconv.FormatUint(seq, 10))
+	}
+
+	if err = putFrom(dlb, dinb, dkey, b, inb, key, &env, RejectOverwrite, tx.indexes(dlq), tx.now()); err != nil {
+		return err
+	}
+
+	return remove(b, inb, key)
+}
+
+// Get the key a dead letter had in the bucket it was moved from
+func sourceKey(kv ChunkData) string {
+
+	if keys := kv.Headers[HeaderDeadLetterKey]; len(keys) == 1 {
+		return keys[0]
+	}
+
+	return kv.Key
+}
+
+// Get the dead-letter policy of a bucket. The dead-letter bucket is empty if there is none.
+func deadLetter(inb *bolt.Bucket) (dlq string, maxReleases int) {
+
+	conf := inb.Bucket(recConfBucket)
+	if conf == nil {
+		return ``, 0
+	}
+
+	dlq = string(conf.Get(confDeadLetterKey))
+	maxReleases, _ = strconv.Atoi(string(conf.Get(confMaxReleasesKey)))
+
+	return dlq, maxReleases
+}
+
+// Check if a reserved record has been released as many times as the dead-letter policy of its bucket allows,
+// so that releasing it again moves it to the dead-letter bucket. Every reservation is a delivery attempt
+// and every attempt but an acknowledged one ends with a release.
+func exhausted(inb *bolt.Bucket, key []byte) bool {
+
+	dlq, maxReleases := deadLetter(inb)
+	if dlq == `` {
+		return false
+	}
+
+	return envelope(inb, key).Attempts > maxReleases
+}
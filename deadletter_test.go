@@ -0,0 +1,285 @@
+package lokaldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeadLetter(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		lease Lease
+		chunk []ChunkData
+		dlq   string
+		max   int
+		n     int
+		now   = time.Now()
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.SetDeadLetter(`default`, `default`, 1); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("set dead letter to itself: got %v, want %v", err, ErrInvalidPolicy)
+	}
+	if err = db.SetDeadLetter(`default`, `dlq`, 1); err != nil {
+		t.Fatalf("set dead letter: %s", err)
+	}
+	if dlq, max, err = db.DeadLetter(`default`); err != nil || dlq != `dlq` || max != 1 {
+		t.Fatalf("dead letter: got %q %d %v, want dlq 1", dlq, max, err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = db.StoreRecord(`default`, ChunkData{
+			Key:      fmt.Sprintf("m%02d", i),
+			Value:    []byte(fmt.Sprintf("%d", i)),
+			Envelope: Envelope{Headers: map[string][]string{`Subject`: {`orders`}}},
+		}); err != nil {
+			t.Fatalf("store record: %s", err)
+		}
+	}
+
+	// The first release is allowed
+	if lease, err = db.Reserve(`default`, 2, time.Minute); err != nil || keysOf(lease.Records) != `m01 m02 ` {
+		t.Fatalf("reserve: got %q %v, want m01 m02", keysOf(lease.Records), err)
+	}
+	if err = db.NackWithReason(lease.ID, `rejected`); err != nil {
+		t.Fatalf("nack: %s", err)
+	}
+
+	// The second release moves m01 to the dead-letter bucket, while m02 expires and is moved by the next reserve
+	if lease, err = db.Reserve(`default`, 2, time.Minute); err != nil || keysOf(lease.Records) != `m01 m02 ` {
+		t.Fatalf("reserve again: got %q %v, want m01 m02", keysOf(lease.Records), err)
+	}
+	if err = db.NackWithReason(lease.ID, `rejected`, `m01`); err != nil {
+		t.Fatalf("nack with reason: %s", err)
+	}
+
+	db.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+	if lease, err = db.Reserve(`default`, 2, time.Minute); err != nil || keysOf(lease.Records) != `m03 ` {
+		t.Fatalf("reserve after expiry: got %q %v, want m03", keysOf(lease.Records), err)
+	}
+	if err = db.Ack(lease.ID); err != nil {
+		t.Fatalf("ack: %s", err)
+	}
+
+	if chunk, err = db.FetchChunkDown(`dlq`, 0, 0); err != nil || keysOf(chunk) != `m01 m02 ` {
+		t.Fatalf("fetch dead letters: got %q %v, want m01 m02", keysOf(chunk), err)
+	}
+	for i, reason := range []string{`rejected`, ReasonLeaseExpired} {
+		kv := chunk[i]
+		if got := kv.Headers[HeaderDeadLetterReason]; len(got) != 1 || got[0] != reason {
+			t.Fatalf("reason of %s: got %v, want %s", kv.Key, got, reason)
+		}
+		if got := kv.Headers[HeaderDeadLetterSource]; len(got) != 1 || got[0] != `default` {
+			t.Fatalf("source of %s: got %v, want default", kv.Key, got)
+		}
+		if kv.Attempts != 2 || kv.Headers[`Subject`][0] != `orders` || string(kv.Value) != fmt.Sprintf("%d", i+1) {
+			t.Fatalf("dead letter %s: got %d %v %q", kv.Key, kv.Attempts, kv.Headers, kv.Value)
+		}
+	}
+	if n, err = db.Count(`default`); err != nil || n != 0 {
+		t.Fatalf("count: got %d %v, want 0", n, err)
+	}
+
+	if n, err = db.Redrive(`dlq`, `dlq`, 0); !errors.Is(err, ErrInvalidPolicy) || n != 0 {
+		t.Fatalf("redrive to itself: got %d %v, want %v", n, err, ErrInvalidPolicy)
+	}
+	if n, err = db.Count(`dlq`); err != nil || n != 2 {
+		t.Fatalf("count after redrive to itself: got %d %v, want 2", n, err)
+	}
+
+	// Redrive sends the records back with a clean envelope
+	if n, err = db.Redrive(`dlq`, `default`, 1); err != nil || n != 1 {
+		t.Fatalf("redrive: got %d %v, want 1", n, err)
+	}
+	if n, err = db.Redrive(`dlq`, `default`, 0); err != nil || n != 1 {
+		t.Fatalf("redrive all: got %d %v, want 1", n, err)
+	}
+	if n, err = db.Redrive(`dlq`, `default`, 0); err != nil || n != 0 {
+		t.Fatalf("redrive empty: got %d %v, want 0", n, err)
+	}
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m01 m02 ` {
+		t.Fatalf("fetch redriven: got %q %v, want m01 m02", keysOf(chunk), err)
+	}
+	if kv := chunk[0]; kv.Attempts != 0 || len(kv.Headers) != 1 || kv.Headers[`Subject`][0] != `orders` {
+		t.Fatalf("redriven envelope: got %d %v", kv.Attempts, kv.Headers)
+	}
+
+	// Without a policy records are released forever
+	if err = db.SetDeadLetter(`default`, ``, 0); err != nil {
+		t.Fatalf("remove dead letter: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		if lease, err = db.Reserve(`default`, 1, time.Minute); err != nil || keysOf(lease.Records) != `m01 ` {
+			t.Fatalf("reserve without policy: got %q %v, want m01", keysOf(lease.Records), err)
+		}
+		if err = db.Nack(lease.ID); err != nil {
+			t.Fatalf("nack without policy: %s", err)
+		}
+	}
+	if dlq, _, err = db.DeadLetter(`default`); err != nil || dlq != `` {
+		t.Fatalf("dead letter removed: got %q %v, want none", dlq, err)
+	}
+}
+
+func TestDeadLetterEmpty(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	// Setting the dead-letter policy creates the bucket without records
+	if err = db.SetDeadLetter(`y`, `ydlq`, 1); err != nil {
+		t.Fatalf("set dead letter: %s", err)
+	}
+	checkEmpty(t, db, `y`)
+}
+
+func TestRedriveNewer(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		lease Lease
+		data  []byte
+		n     int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.SetDeadLetter(`default`, `dlq`, 0); err != nil {
+		t.Fatalf("set dead letter: %s", err)
+	}
+	for _, key := range []string{`m01`, `m02`} {
+		if err = db.Store(`default`, key, []byte(`old`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+	if lease, err = db.Reserve(`default`, 2, time.Minute); err != nil || keysOf(lease.Records) != `m01 m02 ` {
+		t.Fatalf("reserve: got %q %v, want m01 m02", keysOf(lease.Records), err)
+	}
+	if err = db.Nack(lease.ID); err != nil {
+		t.Fatalf("nack: %s", err)
+	}
+
+	// A newer state of m01 is stored while the old one is dead-lettered
+	if err = db.Store(`default`, `m01`, []byte(`new`)); err != nil {
+		t.Fatalf("store new: %s", err)
+	}
+
+	if n, err = db.Redrive(`dlq`, `default`, 0); err != nil || n != 1 {
+		t.Fatalf("redrive: got %d %v, want 1", n, err)
+	}
+	if data, err = db.Fetch(`default`, `m01`); err != nil || string(data) != `new` {
+		t.Fatalf("fetch newer: got %q %v, want new", data, err)
+	}
+	if data, err = db.Fetch(`default`, `m02`); err != nil || string(data) != `old` {
+		t.Fatalf("fetch redriven: got %q %v, want old", data, err)
+	}
+	if data, err = db.Fetch(`dlq`, `m01`); err != nil || string(data) != `old` {
+		t.Fatalf("fetch left in dead letters: got %q %v, want old", data, err)
+	}
+}
+
+func TestDeadLetterSameKey(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		lease Lease
+		chunk []ChunkData
+		n     int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.SetDeadLetter(`default`, `dlq`, 0); err != nil {
+		t.Fatalf("set dead letter: %s", err)
+	}
+
+	// Two poison messages with the same key
+	for _, v := range []string{`first`, `second`} {
+		if err = db.Store(`default`, `m01`, []byte(v)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+		if lease, err = db.Reserve(`default`, 1, time.Minute); err != nil || keysOf(lease.Records) != `m01 ` {
+			t.Fatalf("reserve: got %q %v, want m01", keysOf(lease.Records), err)
+		}
+		if err = db.Nack(lease.ID); err != nil {
+			t.Fatalf("nack: %s", err)
+		}
+	}
+
+	if chunk, err = db.FetchChunkDown(`dlq`, 0, 0); err != nil || len(chunk) != 2 {
+		t.Fatalf("fetch dead letters: got %q %v, want two", keysOf(chunk), err)
+	}
+	for i, v := range []string{`first`, `second`} {
+		if kv := chunk[i]; string(kv.Value) != v || kv.Headers[HeaderDeadLetterKey][0] != `m01` {
+			t.Fatalf("dead letter %d: got %q %q %v, want %s", i, kv.Key, kv.Value, kv.Headers[HeaderDeadLetterKey], v)
+		}
+	}
+	if chunk[0].Key != `m01` || chunk[1].Key == `m01` {
+		t.Fatalf("dead letter keys: got %q, want m01 and a new key", keysOf(chunk))
+	}
+
+	// Records go back under their own key, one dead letter at a time
+	if n, err = db.Redrive(`dlq`, `default`, 0); err != nil || n != 1 {
+		t.Fatalf("redrive: got %d %v, want 1", n, err)
+	}
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m01 ` || string(chunk[0].Value) != `first` {
+		t.Fatalf("fetch redriven: got %q %v, want m01 first", keysOf(chunk), err)
+	}
+	if _, ok := chunk[0].Headers[HeaderDeadLetterKey]; ok {
+		t.Fatalf("redriven headers: got %v", chunk[0].Headers)
+	}
+	if n, err = db.Count(`dlq`); err != nil || n != 1 {
+		t.Fatalf("count dead letters: got %d %v, want 1", n, err)
+	}
+}
+
+func TestDeadLetterContext(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		dlq string
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.SetDeadLetter(`default`, `dlq`, 1); err != nil {
+		t.Fatalf("set dead letter: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = db.SetDeadLetterCtx(ctx, `default`, ``, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("remove dead letter: got %v, want %v", err, context.Canceled)
+	}
+	if _, _, err = db.DeadLetterCtx(ctx, `default`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("dead letter: got %v, want %v", err, context.Canceled)
+	}
+	if dlq, _, err = db.DeadLetterCtx(context.Background(), `default`); err != nil || dlq != `dlq` {
+		t.Fatalf("dead letter after cancel: got %q %v, want dlq", dlq, err)
+	}
+}
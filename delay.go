@@ -0,0 +1,266 @@
+package lokaldb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Stats are the numbers of records of a bucket by state
+type Stats struct {
+	Total   int // All the records, as returned by Count
+	Ready   int // Records that can be consumed now
+	Leased  int // Records reserved by a lease that has not expired
+	Delayed int // Records stored with StoreAt or StoreAfter that are not due yet
+	Expired int // Records whose TTL has passed that are not removed yet
+}
+
+// Name of the bucket inside the internal bucket that keeps the due times of delayed records
+var recDueBucket []byte = []byte(`B73cojFZS1COqkUAV3q4`)
+
+// Names of the buckets of a timeline with the records by time and the time of each key
+var (
+	timeBucket    = []byte(`t`)
+	timeKeyBucket = []byte(`k`)
+)
+
+// StoreAt inserts data in the local database like Store, but the record is not ready until the time.
+// Until then it keeps its position but is skipped by the operations that consume records, like SliceDown,
+// CutChunkDown, FetchChunkDown, PeekHead and Reserve, so ready records are still consumed in FIFO order.
+// A time that has passed stores a ready record. Storing the record again without a time makes it ready.
+//
+//	err = db.StoreAt(`notifications`, `reminder-42`, data, appointment.Add(-time.Hour))
+func (db *LokalDB) StoreAt(bucket string, key string, data []byte, notBefore time.Time) error {
+	return db.StoreAtCtx(context.Background(), bucket, key, data, notBefore)
+}
+
+// StoreAtCtx is StoreAt with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreAtCtx(ctx context.Context, bucket string, key string, data []byte, notBefore time.Time) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.StoreAt(bucket, key, data, notBefore)
+	})
+}
+
+// StoreAfter inserts data in the local database like StoreAt, with a record that is ready after the delay
+func (db *LokalDB) StoreAfter(bucket string, key string, data []byte, delay time.Duration) error {
+	return db.StoreAfterCtx(context.Background(), bucket, key, data, delay)
+}
+
+// StoreAfterCtx is StoreAfter with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreAfterCtx(ctx context.Context, bucket string, key string, data []byte, delay time.Duration) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.StoreAfter(bucket, key, data, delay)
+	})
+}
+
+// Stats counts the records of the bucket by state. Records are ready unless they are reserved, delayed or expired.
+func (db *LokalDB) Stats(bucket string) (Stats, error) {
+	return db.StatsCtx(context.Background(), bucket)
+}
+
+// StatsCtx is Stats with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) StatsCtx(ctx context.Context, bucket string) (st Stats, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		st, err = tx.Stats(bucket)
+		return
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	return
+}
+
+// StoreAt inserts data in the bucket like Store, with a record that is not ready until the time
+func (tx *Tx) StoreAt(bucket string, key string, data []byte, notBefore time.Time) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		keyb   = []byte(key)
+	)
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	if err = put(b, inb, keyb, data, nil, BucketPolicy, tx.indexes(bucket), tx.now()); err != nil {
+		return err
+	}
+
+	if !notBefore.After(tx.now()) {
+		return nil
+	}
+
+	return schedule(inb, recDueBucket, keyb, notBefore)
+}
+
+// StoreAfter inserts data in the bucket like Store, with a record that is ready after the delay
+func (tx *Tx) StoreAfter(bucket string, key string, data []byte, delay time.Duration) error {
+	return tx.StoreAt(bucket, key, data, tx.now().Add(delay))
+}
+
+// Stats counts the records of the bucket by state. Each record is counted once: expired records
+// are expired even if they are reserved or delayed, and reserved records are not counted as delayed.
+func (tx *Tx) Stats(bucket string) (Stats, error) {
+
+	var (
+		err error
+		inb *bolt.Bucket
+		st  Stats
+		now = tx.now()
+	)
+
+	if _, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return st, err
+	}
+
+	st.Total = getint(inb, recCntKey)
+
+	// Only the records that have expired are read
+	due := timeEntry(now, nil)
+	if tb := timeline(inb, recExpBucket, timeBucket); tb != nil {
+		c := tb.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:len(due)], due) <= 0; k, _ = c.Next() {
+			if err = tx.ctx.Err(); err != nil {
+				return Stats{}, err
+			}
+			st.Expired++
+		}
+	}
+
+	// Only the records that are not due yet are read
+	if tb := timeline(inb, recDueBucket, timeBucket); tb != nil {
+		c := tb.Cursor()
+		for k, _ := c.Seek(timeEntry(now.Add(time.Nanosecond), nil)); k != nil; k, _ = c.Next() {
+			if err = tx.ctx.Err(); err != nil {
+				return Stats{}, err
+			}
+			if key := k[len(due):]; !expired(inb, key, now) && !leased(inb, key, now) {
+				st.Delayed++
+			}
+		}
+	}
+
+	if lb := inb.Bucket(recLeaseBucket); lb != nil && lb.Bucket(leaseKeyBucket) != nil {
+		err = lb.Bucket(leaseKeyBucket).ForEach(func(k, _ []byte) error {
+			if err := tx.ctx.Err(); err != nil {
+				return err
+			}
+			if leased(inb, k, now) && !expired(inb, k, now) {
+				st.Leased++
+			}
+			return nil
+		})
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+
+	st.Ready = st.Total - st.Leased - st.Delayed - st.Expired
+
+	return st, nil
+}
+
+// Add a record to a timeline of records kept by time, like the due times or the expiry times
+func schedule(inb *bolt.Bucket, name []byte, key []byte, at time.Time) error {
+
+	tr, err := inb.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	tb, err := tr.CreateBucketIfNotExists(timeBucket)
+	if err != nil {
+		return err
+	}
+	kb, err := tr.CreateBucketIfNotExists(timeKeyBucket)
+	if err != nil {
+		return err
+	}
+
+	if err = unschedule(inb, name, key); err != nil {
+		return err
+	}
+
+	if err = tb.Put(timeEntry(at, key), []byte{}); err != nil {
+		return err
+	}
+
+	return kb.Put(key, []byte(strconv.FormatInt(at.UnixNano(), 10)))
+}
+
+// Remove a record from a timeline, if it is in it
+func unschedule(inb *bolt.Bucket, name []byte, key []byte) error {
+
+	at, ok := scheduled(inb, name, key)
+	if !ok {
+		return nil
+	}
+
+	if err := timeline(inb, name, timeBucket).Delete(timeEntry(time.Unix(0, at), key)); err != nil {
+		return err
+	}
+
+	return timeline(inb, name, timeKeyBucket).Delete(key)
+}
+
+// Get the time of a record in a timeline in nanoseconds. The boolean is false if it is not in it.
+func scheduled(inb *bolt.Bucket, name []byte, key []byte) (int64, bool) {
+
+	if inb == nil {
+		return 0, false
+	}
+
+	kb := timeline(inb, name, timeKeyBucket)
+	if kb == nil {
+		return 0, false
+	}
+
+	v := kb.Get(key)
+	if v == nil {
+		return 0, false
+	}
+
+	at, _ := strconv.ParseInt(string(v), 10, 64)
+
+	return at, true
+}
+
+// Check if a record is not due yet at the time
+func delayed(inb *bolt.Bucket, key []byte, now time.Time) bool {
+	due, ok := scheduled(inb, recDueBucket, key)
+	return ok && now.UnixNano() < due
+}
+
+// Check if a record of the bucket is not due yet at the time. Only the last entry of the due time index is read.
+func delaying(inb *bolt.Bucket, now time.Time) bool {
+
+	tb := timeline(inb, recDueBucket, timeBucket)
+	if tb == nil {
+		return false
+	}
+
+	k, _ := tb.Cursor().Last()
+	due := timeEntry(now, nil)
+
+	return k != nil && bytes.Compare(k[:len(due)], due) > 0
+}
+
+// Get a bucket of a timeline. It is nil if no record was ever added to it.
+func timeline(inb *bolt.Bucket, name []byte, sub []byte) *bolt.Bucket {
+
+	tr := inb.Bucket(name)
+	if tr == nil {
+		return nil
+	}
+
+	return tr.Bucket(sub)
+}
+
+// Key of a timeline entry. Entries are in the order of their times.
+func timeEntry(at time.Time, key []byte) []byte {
+	return append([]byte(fmt.Sprintf("%020d\x00", at.UnixNano())), key...)
+}
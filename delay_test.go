@@ -0,0 +1,147 @@
+package lokaldb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+		lease Lease
+		st    Stats
+		now   = time.Now()
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	db.now = func() time.Time { return now }
+
+	if err = db.StoreAfter(`default`, `m01`, []byte(`1`), time.Minute); err != nil {
+		t.Fatalf("store after: %s", err)
+	}
+	if err = db.Store(`default`, `m02`, []byte(`2`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if err = db.StoreAt(`default`, `m03`, []byte(`3`), now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("store at: %s", err)
+	}
+	if err = db.StoreAt(`default`, `m04`, []byte(`4`), now.Add(-time.Minute)); err != nil {
+		t.Fatalf("store at past: %s", err)
+	}
+	if err = db.StoreAfter(`default`, `m05`, []byte(`5`), time.Hour); err != nil {
+		t.Fatalf("store after: %s", err)
+	}
+
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m02 m04 ` {
+		t.Fatalf("fetch chunk down: got %q %v, want m02 m04", keysOf(chunk), err)
+	}
+	if st, err = db.Stats(`default`); err != nil || st != (Stats{Total: 5, Ready: 2, Delayed: 3}) {
+		t.Fatalf("stats: got %+v %v, want 5 ready 2 delayed 3", st, err)
+	}
+	if kv, ok, err := db.PeekHead(`default`); err != nil || !ok || kv.Key != `m02` {
+		t.Fatalf("peek head: got %q %v %v, want m02", kv.Key, ok, err)
+	}
+
+	// Due records are ready at their position
+	db.now = func() time.Time { return now.Add(90 * time.Second) }
+
+	if lease, err = db.Reserve(`default`, 1, time.Minute); err != nil || keysOf(lease.Records) != `m01 ` {
+		t.Fatalf("reserve: got %q %v, want m01", keysOf(lease.Records), err)
+	}
+	if st, err = db.Stats(`default`); err != nil || st != (Stats{Total: 5, Ready: 2, Leased: 1, Delayed: 2}) {
+		t.Fatalf("stats after reserve: got %+v %v", st, err)
+	}
+	if chunk, err = db.CutChunkDown(`default`, 0); err != nil || keysOf(chunk) != `m02 m04 ` {
+		t.Fatalf("cut chunk down: got %q %v, want m02 m04", keysOf(chunk), err)
+	}
+
+	// Storing a record again without a time makes it ready
+	if err = db.Store(`default`, `m05`, []byte(`5`)); err != nil {
+		t.Fatalf("store again: %s", err)
+	}
+
+	db.now = func() time.Time { return now.Add(3 * time.Minute) }
+
+	if data, err := db.SliceDown(`default`); err != nil || string(data) != `1` {
+		t.Fatalf("slice down: got %q %v, want 1", data, err)
+	}
+	if chunk, err = db.CutChunkDown(`default`, 0); err != nil || keysOf(chunk) != `m03 m05 ` {
+		t.Fatalf("cut chunk down after due: got %q %v, want m03 m05", keysOf(chunk), err)
+	}
+	if st, err = db.Stats(`default`); err != nil || st != (Stats{}) {
+		t.Fatalf("stats empty: got %+v %v, want zero", st, err)
+	}
+}
+
+func TestDelayDeleteUpTo(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+		n     int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.StoreAfter(`default`, `m01`, []byte(`1`), time.Hour); err != nil {
+		t.Fatalf("store after: %s", err)
+	}
+	for _, key := range []string{`m02`, `m03`} {
+		if err = db.Store(`default`, key, []byte(key)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	// The replayer forwarded the ready records up to m03
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m02 m03 ` {
+		t.Fatalf("fetch chunk down: got %q %v, want m02 m03", keysOf(chunk), err)
+	}
+	if n, err = db.DeleteUpTo(`default`, chunk[1].Seq); err != nil || n != 2 {
+		t.Fatalf("delete up to: got %d %v, want 2", n, err)
+	}
+	if kv, err := db.FetchBySeq(`default`, 1); err != nil || kv.Key != `m01` {
+		t.Fatalf("delayed record: got %q %v, want m01", kv.Key, err)
+	}
+}
+
+func TestDelayStats(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		lease Lease
+		st    Stats
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.Store(`default`, `m01`, []byte(`1`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if lease, err = db.Reserve(`default`, 1, time.Minute); err != nil || keysOf(lease.Records) != `m01 ` {
+		t.Fatalf("reserve: got %q %v, want m01", keysOf(lease.Records), err)
+	}
+
+	// A reserved record delayed again is counted once
+	if err = db.StoreAfter(`default`, `m01`, []byte(`1`), time.Hour); err != nil {
+		t.Fatalf("store after: %s", err)
+	}
+	if st, err = db.Stats(`default`); err != nil || st != (Stats{Total: 1, Delayed: 1}) {
+		t.Fatalf("stats: got %+v %v, want 1 delayed", st, err)
+	}
+}
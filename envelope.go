@@ -0,0 +1,234 @@
+package lokaldb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Name of the bucket inside the internal bucket that keeps the envelope of each key
+var recEnvBucket []byte = []byte(`I2nVsbBi1RMar1jf3YZ4`)
+
+// Envelope is the metadata stored with a record. Records stored by earlier versions have an empty envelope.
+type Envelope struct {
+	Headers     map[string][]string // Headers of the message, compatible with nats.Header
+	ContentType string              // Content type of the value
+	CreatedAt   time.Time           // Time the key was first stored
+	UpdatedAt   time.Time           // Time the key was last stored
+	Attempts    int                 // Number of delivery attempts
+}
+
+// Stored form of an envelope
+type envelopeRecord struct {
+	Headers     map[string][]string `json:"h,omitempty"`
+	ContentType string              `json:"t,omitempty"`
+	CreatedAt   int64               `json:"c,omitempty"`
+	UpdatedAt   int64               `json:"u,omitempty"`
+	Attempts    int                 `json:"a,omitempty"`
+}
+
+// StoreRecord inserts the record with its envelope in the bucket. It will update the record containing the same key.
+// The creation time is kept when the key exists or taken from the record if it is set, and the update time is set to now.
+func (db *LokalDB) StoreRecord(bucket string, kv ChunkData) error {
+	return db.StoreRecordCtx(context.Background(), bucket, kv)
+}
+
+// StoreRecordCtx is StoreRecord with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreRecordCtx(ctx context.Context, bucket string, kv ChunkData) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.StoreRecord(bucket, kv)
+	})
+}
+
+// FetchRecord gets the record with the provided key and its envelope. If there is none, the key of the returned record is empty.
+func (db *LokalDB) FetchRecord(bucket string, key string) (ChunkData, error) {
+	return db.FetchRecordCtx(context.Background(), bucket, key)
+}
+
+// FetchRecordCtx is FetchRecord with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchRecordCtx(ctx context.Context, bucket string, key string) (kv ChunkData, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		kv, err = tx.FetchRecord(bucket, key)
+		return
+	})
+	if err != nil {
+		return ChunkData{}, err
+	}
+	return
+}
+
+// SliceUpRecord fetches and deletes a record with its envelope from bottom to top. If there is none, the key of the returned record is empty.
+func (db *LokalDB) SliceUpRecord(bucket string) (ChunkData, error) {
+	return db.SliceUpRecordCtx(context.Background(), bucket)
+}
+
+// SliceUpRecordCtx is SliceUpRecord with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) SliceUpRecordCtx(ctx context.Context, bucket string) (kv ChunkData, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		kv, err = tx.SliceUpRecord(bucket)
+		return
+	})
+	if err != nil {
+		return ChunkData{}, err
+	}
+	return
+}
+
+// SliceDownRecord fetches and deletes a record with its envelope from top to bottom. If there is none, the key of the returned record is empty.
+func (db *LokalDB) SliceDownRecord(bucket string) (ChunkData, error) {
+	return db.SliceDownRecordCtx(context.Background(), bucket)
+}
+
+// SliceDownRecordCtx is SliceDownRecord with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) SliceDownRecordCtx(ctx context.Context, bucket string) (kv ChunkData, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		kv, err = tx.SliceDownRecord(bucket)
+		return
+	})
+	if err != nil {
+		return ChunkData{}, err
+	}
+	return
+}
+
+// StoreRecord inserts the record with its envelope in the bucket. It will update the record containing the same key.
+func (tx *Tx) StoreRecord(bucket string, kv ChunkData) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	return put(b, inb, []byte(kv.Key), kv.Value, &kv.Envelope, BucketPolicy, tx.indexes(bucket), tx.now())
+}
+
+// FetchRecord gets the record with the provided key and its envelope. If there is none, the key of the returned record is empty.
+func (tx *Tx) FetchRecord(bucket string, key string) (ChunkData, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		keyb   = []byte(key)
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return ChunkData{}, err
+	}
+
+	if b.Get(keyb) == nil || expired(inb, keyb, tx.now()) {
+		return ChunkData{}, nil
+	}
+
+	return record(b, inb, keyb, getint(inb, keyb)), nil
+}
+
+// SliceUpRecord fetches and deletes a record with its envelope from bottom to top
+func (tx *Tx) SliceUpRecord(bucket string) (ChunkData, error) {
+	return tx.slice(bucket, false)
+}
+
+// SliceDownRecord fetches and deletes a record with its envelope from top to bottom
+func (tx *Tx) SliceDownRecord(bucket string) (ChunkData, error) {
+	return tx.slice(bucket, true)
+}
+
+// Get the envelope of a key. Keys without a stored envelope have an empty envelope.
+func envelope(inb *bolt.Bucket, key []byte) Envelope {
+
+	var (
+		env Envelope
+		er  envelopeRecord
+	)
+
+	eb := inb.Bucket(recEnvBucket)
+	if eb == nil {
+		return env
+	}
+
+	v := eb.Get(key)
+	if v == nil || json.Unmarshal(v, &er) != nil {
+		return env
+	}
+
+	env.Headers = er.Headers
+	env.ContentType = er.ContentType
+	env.Attempts = er.Attempts
+	if er.CreatedAt != 0 {
+		env.CreatedAt = time.Unix(0, er.CreatedAt)
+	}
+	if er.UpdatedAt != 0 {
+		env.UpdatedAt = time.Unix(0, er.UpdatedAt)
+	}
+
+	return env
+}
+
+// Store the envelope of a key
+func putEnvelope(inb *bolt.Bucket, key []byte, env Envelope) error {
+
+	er := envelopeRecord{
+		Headers:     env.Headers,
+		ContentType: env.ContentType,
+		Attempts:    env.Attempts,
+	}
+	if !env.CreatedAt.IsZero() {
+		er.CreatedAt = env.CreatedAt.UnixNano()
+	}
+	if !env.UpdatedAt.IsZero() {
+		er.UpdatedAt = env.UpdatedAt.UnixNano()
+	}
+
+	v, err := json.Marshal(er)
+	if err != nil {
+		return err
+	}
+
+	eb, err := inb.CreateBucketIfNotExists(recEnvBucket)
+	if err != nil {
+		return err
+	}
+
+	return eb.Put(key, v)
+}
+
+// Update the envelope of a key that has just been stored at the time. A nil envelope keeps the
+// headers, content type and attempts of the existing record.
+func stampEnvelope(inb *bolt.Bucket, key []byte, env *Envelope, existed bool, now time.Time) error {
+
+	var cur Envelope
+
+	if existed {
+		cur = envelope(inb, key)
+	}
+
+	if env != nil {
+		created := cur.CreatedAt
+		cur = *env
+		if !created.IsZero() {
+			cur.CreatedAt = created
+		}
+	}
+
+	if cur.CreatedAt.IsZero() {
+		cur.CreatedAt = now
+	}
+	cur.UpdatedAt = now
+
+	return putEnvelope(inb, key, cur)
+}
+
+// Forget the envelope of a removed key
+func dropEnvelope(inb *bolt.Bucket, key []byte) error {
+
+	if eb := inb.Bucket(recEnvBucket); eb != nil {
+		return eb.Delete(key)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package lokaldb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvelopes(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		kv    ChunkData
+		chunk []ChunkData
+		data  []byte
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	spooled := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	err = db.StoreRecord(`outbound`, ChunkData{
+		Key:   `order-a`,
+		Value: []byte(`{"id":1}`),
+		Envelope: Envelope{
+			Headers:     map[string][]string{`Subject`: {`orders.created`}, `Nats-Msg-Id`: {`order-a`}},
+			ContentType: `application/json`,
+			CreatedAt:   spooled,
+			Attempts:    2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("store record: %s", err)
+	}
+
+	if kv, err = db.FetchRecord(`outbound`, `order-a`); err != nil || kv.Key != `order-a` {
+		t.Fatalf("fetch record: got %+v, %v", kv, err)
+	}
+	if kv.Headers[`Subject`][0] != `orders.created` || kv.ContentType != `application/json` || kv.Attempts != 2 {
+		t.Fatalf("fetch record: got envelope %+v", kv.Envelope)
+	}
+	if !kv.CreatedAt.Equal(spooled) || kv.UpdatedAt.Before(kv.CreatedAt) {
+		t.Fatalf("fetch record: got created %s, updated %s", kv.CreatedAt, kv.UpdatedAt)
+	}
+
+	// A plain store keeps the envelope and the creation time
+	if err = db.Store(`outbound`, `order-a`, []byte(`{"id":2}`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if chunk, err = db.FetchChunkDown(`outbound`, 1, 0); err != nil || len(chunk) != 1 {
+		t.Fatalf("fetch chunk down: got %v, %v", chunk, err)
+	}
+	if string(chunk[0].Value) != `{"id":2}` || chunk[0].ContentType != `application/json` || !chunk[0].CreatedAt.Equal(spooled) {
+		t.Fatalf("fetch chunk down: got %+v", chunk[0])
+	}
+
+	// Records moved with StoreOnce keep their envelope
+	err = db.Update(func(tx *Tx) error {
+		chunk, err := tx.CutChunkDown(`outbound`, 0)
+		if err != nil {
+			return err
+		}
+		return tx.StoreOnce(`inflight`, chunk)
+	})
+	if err != nil {
+		t.Fatalf("update: %s", err)
+	}
+	if kv, err = db.SliceDownRecord(`inflight`); err != nil || kv.Key != `order-a` {
+		t.Fatalf("slice down record: got %+v, %v", kv, err)
+	}
+	if kv.Headers[`Nats-Msg-Id`][0] != `order-a` || !kv.CreatedAt.Equal(spooled) {
+		t.Fatalf("slice down record: got envelope %+v", kv.Envelope)
+	}
+	if kv, err = db.SliceDownRecord(`inflight`); err != nil || kv.Key != `` {
+		t.Fatalf("slice down record empty: got %+v, %v", kv, err)
+	}
+
+	// Records stored by earlier versions have no envelope
+	if err = db.Store(`legacy`, `raw`, []byte(`raw value`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	err = db.Update(func(tx *Tx) error {
+		_, inb, err := tx.bucket(`legacy`)
+		if err != nil {
+			return err
+		}
+		return inb.DeleteBucket(recEnvBucket)
+	})
+	if err != nil {
+		t.Fatalf("update: %s", err)
+	}
+	if data, err = db.Fetch(`legacy`, `raw`); err != nil || string(data) != `raw value` {
+		t.Fatalf("fetch legacy: got %q, %v", data, err)
+	}
+	if kv, err = db.FetchRecord(`legacy`, `raw`); err != nil || string(kv.Value) != `raw value` || !kv.CreatedAt.IsZero() || kv.Headers != nil {
+		t.Fatalf("fetch record legacy: got %+v, %v", kv, err)
+	}
+}
+
+func TestEnvelopeClock(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		kv  ChunkData
+		now = time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	// Envelopes are stamped with the clock of the transaction
+	db.now = func() time.Time { return now }
+	if err = db.Store(`outbound`, `order-a`, []byte(`{"id":1}`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+
+	db.now = func() time.Time { return now.Add(time.Minute) }
+	if err = db.Store(`outbound`, `order-a`, []byte(`{"id":2}`)); err != nil {
+		t.Fatalf("store again: %s", err)
+	}
+
+	if kv, err = db.FetchRecord(`outbound`, `order-a`); err != nil {
+		t.Fatalf("fetch record: %s", err)
+	}
+	if !kv.CreatedAt.Equal(now) || !kv.UpdatedAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("fetch record: got created %s, updated %s, want %s, %s", kv.CreatedAt, kv.UpdatedAt, now, now.Add(time.Minute))
+	}
+}
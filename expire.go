@@ -0,0 +1,338 @@
+package lokaldb
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ExpiredHandler receives the records removed by the background sweeper after their removal is committed
+type ExpiredHandler func(bucket string, expired []ChunkData)
+
+// Name of the bucket inside the internal bucket that keeps the expiry times of records with a TTL
+var recExpBucket []byte = []byte(`WZwmT2OxHTQi5TMpUFn3`)
+
+// Configuration keys
+var confTTLKey []byte = []byte(`ttl`)
+
+// Number of expired records removed in each transaction of the background sweeper unless set
+const defaultSweepBatchSize = 500
+
+// WithSweeper starts a background sweeper when the database is opened. Every interval, it removes the
+// expired records of all buckets in transactions of up to batchSize records, so that writers are never
+// blocked for long. A batch size of zero uses 500. The sweeper stops when the database is closed.
+func WithSweeper(interval time.Duration, batchSize int) Option {
+	return func(db *LokalDB) {
+		db.SweepInterval = interval
+		db.SweepBatchSize = batchSize
+	}
+}
+
+// WithExpiredHandler sets the function that receives the records removed by the background sweeper
+func WithExpiredHandler(fn ExpiredHandler) Option {
+	return func(db *LokalDB) {
+		db.OnExpired = fn
+	}
+}
+
+// StoreWithTTL inserts data in the local database like Store, with a record that expires after the TTL.
+// Expired records are skipped by reads and removed by Sweep or the background sweeper.
+//
+//	err = db.StoreWithTTL(`prices`, `EURUSD`, data, time.Hour)
+func (db *LokalDB) StoreWithTTL(bucket string, key string, data []byte, ttl time.Duration) error {
+	return db.StoreWithTTLCtx(context.Background(), bucket, key, data, ttl)
+}
+
+// StoreWithTTLCtx is StoreWithTTL with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreWithTTLCtx(ctx context.Context, bucket string, key string, data []byte, ttl time.Duration) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.StoreWithTTL(bucket, key, data, ttl)
+	})
+}
+
+// SetTTL sets the default TTL of the records stored in the bucket without one. Records already stored keep
+// their expiry time. The bucket is created if it does not exist. A TTL of zero removes the default.
+func (db *LokalDB) SetTTL(bucket string, ttl time.Duration) error {
+	return db.SetTTLCtx(context.Background(), bucket, ttl)
+}
+
+// SetTTLCtx is SetTTL with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) SetTTLCtx(ctx context.Context, bucket string, ttl time.Duration) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.SetTTL(bucket, ttl)
+	})
+}
+
+// TTL gets the default TTL of the records stored in the bucket. It is zero if there is none.
+func (db *LokalDB) TTL(bucket string) (time.Duration, error) {
+	return db.TTLCtx(context.Background(), bucket)
+}
+
+// TTLCtx is TTL with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) TTLCtx(ctx context.Context, bucket string) (ttl time.Duration, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		ttl, err = tx.TTL(bucket)
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// Sweep removes up to max expired records of the bucket, the ones that expired first, and returns them.
+// A maximum of zero removes all of them.
+func (db *LokalDB) Sweep(bucket string, max int) ([]ChunkData, error) {
+	return db.SweepCtx(context.Background(), bucket, max)
+}
+
+// SweepCtx is Sweep with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) SweepCtx(ctx context.Context, bucket string, max int) (chunk []ChunkData, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		chunk, err = tx.Sweep(bucket, max)
+		return
+	})
+	if err != nil {
+		return []ChunkData{}, err
+	}
+	return
+}
+
+// StoreWithTTL inserts data in the bucket like Store, with a record that expires after the TTL
+func (tx *Tx) StoreWithTTL(bucket string, key string, data []byte, ttl time.Duration) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		keyb   = []byte(key)
+	)
+
+	if ttl <= 0 {
+		return ErrInvalidTimeout
+	}
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	if err = put(b, inb, keyb, data, nil, BucketPolicy, tx.indexes(bucket), tx.now()); err != nil {
+		return err
+	}
+
+	return schedule(inb, recExpBucket, keyb, tx.now().Add(ttl))
+}
+
+// SetTTL sets the default TTL of the records stored in the bucket. The bucket is created if it does not exist.
+func (tx *Tx) SetTTL(bucket string, ttl time.Duration) error {
+
+	var (
+		err  error
+		inb  *bolt.Bucket
+		conf *bolt.Bucket
+	)
+
+	if ttl < 0 {
+		return ErrInvalidTimeout
+	}
+
+	if _, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	if conf, err = inb.CreateBucketIfNotExists(recConfBucket); err != nil {
+		return err
+	}
+
+	if ttl == 0 {
+		return conf.Delete(confTTLKey)
+	}
+
+	return conf.Put(confTTLKey, []byte(strconv.FormatInt(int64(ttl), 10)))
+}
+
+// TTL gets the default TTL of the records stored in the bucket
+func (tx *Tx) TTL(bucket string) (time.Duration, error) {
+
+	var (
+		err error
+		inb *bolt.Bucket
+	)
+
+	if _, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return 0, err
+	}
+
+	return bucketTTL(inb), nil
+}
+
+// Sweep removes up to max expired records of the bucket and returns them
+func (tx *Tx) Sweep(bucket string, max int) ([]ChunkData, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		chunk  = make([]ChunkData, 0)
+		keys   [][]byte
+		now    = timeEntry(tx.now(), nil)
+	)
+
+	if max < 0 {
+		return chunk, ErrInvalidLimit
+	}
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return chunk, err
+	}
+
+	tb := timeline(inb, recExpBucket, timeBucket)
+	if tb == nil {
+		return chunk, nil
+	}
+
+	// Entries are in the order of their expiry times, so only the expired ones are read
+	c := tb.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k[:len(now)], now) <= 0; k, _ = c.Next() {
+		if err = tx.ctx.Err(); err != nil {
+			return []ChunkData{}, err
+		}
+		if max > 0 && len(keys) == max {
+			break
+		}
+		keyb := bytes.Clone(k[len(now):])
+		chunk = append(chunk, record(b, inb, keyb, getint(inb, keyb)))
+		keys = append(keys, keyb)
+	}
+
+	if len(keys) == 0 {
+		return chunk, nil
+	}
+
+	if err = remove(b, inb, keys...); err != nil {
+		return []ChunkData{}, err
+	}
+
+	return chunk, nil
+}
+
+// Start the background sweeper
+func (db *LokalDB) startSweeper() {
+
+	db.stop = make(chan struct{})
+	db.sweeping.Add(1)
+
+	go func() {
+		defer db.sweeping.Done()
+
+		t := time.NewTicker(db.SweepInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-db.stop:
+				return
+			case <-t.C:
+				db.sweepAll()
+			}
+		}
+	}()
+}
+
+// Stop the background sweeper and wait for it to finish its transaction
+func (db *LokalDB) stopSweeper() {
+
+	if db.stop == nil {
+		return
+	}
+
+	close(db.stop)
+	db.sweeping.Wait()
+	db.stop = nil
+}
+
+// Remove the expired records of all buckets, one batch per transaction
+func (db *LokalDB) sweepAll() {
+
+	var (
+		buckets []string
+		batch   = db.SweepBatchSize
+	)
+
+	if batch <= 0 {
+		batch = defaultSweepBatchSize
+	}
+
+	// Find the buckets with expired records
+	err := db.View(func(tx *Tx) error {
+		now := timeEntry(tx.now(), nil)
+		return tx.tree(``, func(path string, _, inb *bolt.Bucket) error {
+			if inb == nil {
+				return nil
+			}
+			if tb := timeline(inb, recExpBucket, timeBucket); tb != nil {
+				if k, _ := tb.Cursor().First(); k != nil && bytes.Compare(k[:len(now)], now) <= 0 {
+					buckets = append(buckets, path)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return
+	}
+
+	for _, bucket := range buckets {
+		for {
+			select {
+			case <-db.stop:
+				return
+			default:
+			}
+
+			chunk, err := db.Sweep(bucket, batch)
+			if err != nil {
+				break
+			}
+			if len(chunk) > 0 && db.OnExpired != nil {
+				db.OnExpired(bucket, chunk)
+			}
+			if len(chunk) < batch {
+				break
+			}
+		}
+	}
+}
+
+// Give the record stored at the time the default TTL of its bucket, if it has one. Records without a TTL never expire.
+func expireDefault(inb *bolt.Bucket, key []byte, now time.Time) error {
+
+	if err := unschedule(inb, recExpBucket, key); err != nil {
+		return err
+	}
+
+	if ttl := bucketTTL(inb); ttl > 0 {
+		return schedule(inb, recExpBucket, key, now.Add(ttl))
+	}
+
+	return nil
+}
+
+// Get the default TTL of a bucket
+func bucketTTL(inb *bolt.Bucket) time.Duration {
+
+	if conf := inb.Bucket(recConfBucket); conf != nil {
+		if ttl, _ := strconv.ParseInt(string(conf.Get(confTTLKey)), 10, 64); ttl > 0 {
+			return time.Duration(ttl)
+		}
+	}
+
+	return 0
+}
+
+// Check if a record has expired at the time
+func expired(inb *bolt.Bucket, key []byte, now time.Time) bool {
+	at, ok := scheduled(inb, recExpBucket, key)
+	return ok && now.UnixNano() >= at
+}
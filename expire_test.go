@@ -0,0 +1,233 @@
+package lokaldb
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpire(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+		ttl   time.Duration
+		data  []byte
+		st    Stats
+		now   = time.Now()
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	db.now = func() time.Time { return now }
+
+	if err = db.StoreWithTTL(`default`, `m01`, []byte(`1`), 0); !errors.Is(err, ErrInvalidTimeout) {
+		t.Fatalf("store without ttl: got %v, want %v", err, ErrInvalidTimeout)
+	}
+	if err = db.SetTTL(`default`, time.Hour); err != nil {
+		t.Fatalf("set ttl: %s", err)
+	}
+	if ttl, err = db.TTL(`default`); err != nil || ttl != time.Hour {
+		t.Fatalf("ttl: got %v %v, want 1h", ttl, err)
+	}
+
+	if err = db.StoreWithTTL(`default`, `m01`, []byte(`1`), time.Minute); err != nil {
+		t.Fatalf("store with ttl: %s", err)
+	}
+	if err = db.Store(`default`, `m02`, []byte(`2`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if err = db.SetTTL(`default`, 0); err != nil {
+		t.Fatalf("remove ttl: %s", err)
+	}
+	if err = db.Store(`default`, `m03`, []byte(`3`)); err != nil {
+		t.Fatalf("store without default: %s", err)
+	}
+	if err = db.StoreWithTTL(`default`, `m04`, []byte(`4`), time.Minute); err != nil {
+		t.Fatalf("store with ttl: %s", err)
+	}
+
+	// Storing a record again gives it a new expiry time
+	if err = db.Store(`default`, `m04`, []byte(`4`)); err != nil {
+		t.Fatalf("store again: %s", err)
+	}
+
+	db.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+	if data, err = db.Fetch(`default`, `m01`); err != nil || data != nil {
+		t.Fatalf("fetch expired: got %q %v, want nil", data, err)
+	}
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m02 m03 m04 ` {
+		t.Fatalf("fetch chunk down: got %q %v, want m02 m03 m04", keysOf(chunk), err)
+	}
+	if _, missing, err := db.FetchMany(`default`, []string{`m01`, `m02`}); err != nil || len(missing) != 1 || missing[0] != `m01` {
+		t.Fatalf("fetch many: got %v %v, want m01 missing", missing, err)
+	}
+	if st, err = db.Stats(`default`); err != nil || st != (Stats{Total: 4, Ready: 3, Expired: 1}) {
+		t.Fatalf("stats: got %+v %v", st, err)
+	}
+
+	db.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	keys := ``
+	for k := range db.All(`default`) {
+		keys += k + ` `
+	}
+	if keys != `m03 m04 ` {
+		t.Fatalf("all: got %q, want m03 m04", keys)
+	}
+
+	// Sweeping removes the expired records and fixes the count and indexes
+	if chunk, err = db.Sweep(`default`, 1); err != nil || keysOf(chunk) != `m01 ` || string(chunk[0].Value) != `1` {
+		t.Fatalf("sweep: got %q %v, want m01", keysOf(chunk), err)
+	}
+	if chunk, err = db.Sweep(`default`, 0); err != nil || keysOf(chunk) != `m02 ` {
+		t.Fatalf("sweep all: got %q %v, want m02", keysOf(chunk), err)
+	}
+	if chunk, err = db.Sweep(`default`, 0); err != nil || len(chunk) != 0 {
+		t.Fatalf("sweep empty: got %q %v, want nothing", keysOf(chunk), err)
+	}
+	if st, err = db.Stats(`default`); err != nil || st != (Stats{Total: 2, Ready: 2}) {
+		t.Fatalf("stats after sweep: got %+v %v", st, err)
+	}
+	if kv, ok, err := db.PeekHead(`default`); err != nil || !ok || kv.Key != `m03` {
+		t.Fatalf("peek head: got %q %v %v, want m03", kv.Key, ok, err)
+	}
+}
+
+func TestExpireDefaultClock(t *testing.T) {
+	var (
+		err  error
+		db   *LokalDB
+		data []byte
+		now  = time.Now().Add(-2 * time.Hour)
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	// The default TTL counts from the clock of the transaction
+	db.now = func() time.Time { return now }
+	if err = db.SetTTL(`default`, time.Hour); err != nil {
+		t.Fatalf("set ttl: %s", err)
+	}
+	if err = db.Store(`default`, `m01`, []byte(`1`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+
+	db.now = func() time.Time { return now.Add(time.Hour) }
+	if data, err = db.Fetch(`default`, `m01`); err != nil || data != nil {
+		t.Fatalf("fetch expired: got %q %v, want nil", data, err)
+	}
+}
+
+func TestSweeper(t *testing.T) {
+	var (
+		err     error
+		db      *LokalDB
+		removed = make(chan string, 10)
+		bucket  = Path(`prices`, `fx`)
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`),
+		WithSweeper(10*time.Millisecond, 1),
+		WithExpiredHandler(func(bucket string, expired []ChunkData) {
+			for _, kv := range expired {
+				removed <- bucket + ` ` + kv.Key
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+
+	for _, key := range []string{`EURUSD`, `USDJPY`} {
+		if err = db.StoreWithTTL(bucket, key, []byte(`1`), time.Millisecond); err != nil {
+			t.Fatalf("store with ttl: %s", err)
+		}
+	}
+	if err = db.Store(bucket, `GBPUSD`, []byte(`1`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case s := <-removed:
+			got = append(got, s)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sweeper: got %v, want 2 records", got)
+		}
+	}
+	sort.Strings(got)
+	if strings.Join(got, `,`) != bucket+` EURUSD,`+bucket+` USDJPY` {
+		t.Fatalf("sweeper: got %v", got)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	if db, err = Open(db.FileName); err != nil {
+		t.Fatalf("reopen: %s", err)
+	}
+	defer db.Close()
+
+	if cnt, err := db.Count(bucket); err != nil || cnt != 1 {
+		t.Fatalf("count: got %d %v, want 1", cnt, err)
+	}
+}
+
+func TestTTLEmpty(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	// Setting the TTL creates the bucket without records
+	if err = db.SetTTL(`c`, time.Hour); err != nil {
+		t.Fatalf("set ttl: %s", err)
+	}
+	checkEmpty(t, db, `c`)
+}
+
+func TestTTLContext(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		ttl time.Duration
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.SetTTL(`default`, time.Hour); err != nil {
+		t.Fatalf("set ttl: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = db.SetTTLCtx(ctx, `default`, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Fatalf("set ttl: got %v, want %v", err, context.Canceled)
+	}
+	if _, err = db.TTLCtx(ctx, `default`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ttl: got %v, want %v", err, context.Canceled)
+	}
+	if ttl, err = db.TTLCtx(context.Background(), `default`); err != nil || ttl != time.Hour {
+		t.Fatalf("ttl after cancel: got %v %v, want 1h", ttl, err)
+	}
+}
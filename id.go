@@ -0,0 +1,153 @@
+package lokaldb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// IDGenerator generates the key of a record added with Enqueue. It gets the next
+// sequence number of the bucket, which starts at 1 and never repeats in the bucket.
+// The keys must be unique in the bucket and should sort in the order they are generated.
+type IDGenerator func(seq uint64) (string, error)
+
+// SequenceID is the default IDGenerator. It formats the sequence number of the bucket
+// as a zero-padded 20 digit number that sorts lexicographically.
+func SequenceID(seq uint64) (string, error) {
+	return fmt.Sprintf("%020d", seq), nil
+}
+
+// NewUUIDv7 creates an IDGenerator of RFC 9562 version 7 UUIDs. They start with the
+// time in milliseconds, followed by a counter that keeps the UUIDs of the generator
+// increasing within the same millisecond, and random bits.
+func NewUUIDv7() IDGenerator {
+
+	var (
+		mu     sync.Mutex
+		lastms uint64
+		ctr    uint16
+	)
+
+	return func(_ uint64) (string, error) {
+
+		var u [16]byte
+
+		if _, err := rand.Read(u[6:]); err != nil {
+			return ``, err
+		}
+
+		mu.Lock()
+		ms := uint64(time.Now().UnixMilli())
+		if ms <= lastms {
+			// Same millisecond or the clock went back: continue the counter.
+			// Borrow the next millisecond if the 12 bit counter overflows.
+			ms = lastms
+			if ctr++; ctr > 0x0fff {
+				ms, ctr = ms+1, 0
+			}
+		} else {
+			ctr = binary.BigEndian.Uint16(u[6:8]) & 0x07ff
+		}
+		lastms = ms
+		c := ctr
+		mu.Unlock()
+
+		binary.BigEndian.PutUint64(u[0:8], ms<<16|uint64(c))
+		u[6] = 0x70 | u[6]&0x0f
+		u[8] = 0x80 | u[8]&0x3f
+
+		var buf [36]byte
+		hex.Encode(buf[0:8], u[0:4])
+		buf[8] = '-'
+		hex.Encode(buf[9:13], u[4:6])
+		buf[13] = '-'
+		hex.Encode(buf[14:18], u[6:8])
+		buf[18] = '-'
+		hex.Encode(buf[19:23], u[8:10])
+		buf[23] = '-'
+		hex.Encode(buf[24:], u[10:])
+
+		return string(buf[:]), nil
+	}
+}
+
+// WithIDGenerator sets the generator of the keys of records added with Enqueue. The default is SequenceID.
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(db *LokalDB) {
+		db.IDGenerator = gen
+	}
+}
+
+// Enqueue inserts data at the bottom of the bucket with a generated key and returns the key.
+// The key can be used with Fetch, Delete and FetchDelete.
+func (db *LokalDB) Enqueue(bucket string, data []byte) (string, error) {
+	return db.EnqueueCtx(context.Background(), bucket, data)
+}
+
+// EnqueueCtx is Enqueue with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) EnqueueCtx(ctx context.Context, bucket string, data []byte) (id string, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		id, err = tx.Enqueue(bucket, data)
+		return
+	})
+	if err != nil {
+		return ``, err
+	}
+	return
+}
+
+// Enqueue inserts data at the bottom of the bucket with a generated key and returns the key
+func (tx *Tx) Enqueue(bucket string, data []byte) (string, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		seq    uint64
+		id     string
+	)
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return ``, err
+	}
+
+	if seq, err = b.NextSequence(); err != nil {
+		return ``, err
+	}
+
+	gen := tx.db.IDGenerator
+	if gen == nil {
+		gen = SequenceID
+	}
+
+	if id, err = gen(seq); err != nil {
+		return ``, err
+	}
+
+	// Never overwrite a record with a generated key
+	if b.Get([]byte(id)) != nil {
+		return ``, ErrDuplicateID
+	}
+
+	if err = put(b, inb, []byte(id), data, nil, KeepPosition, tx.indexes(bucket), tx.now()); err != nil {
+		return ``, err
+	}
+
+	return id, nil
+}
+
+// Enqueue inserts the value at the bottom of the queue with a generated key and returns the key
+func (q *Queue[T]) Enqueue(v T) (string, error) {
+
+	data, err := q.codec.Encode(v)
+	if err != nil {
+		return ``, &EncodeError{Bucket: q.bucket, Err: err}
+	}
+
+	return q.db.Enqueue(q.bucket, data)
+}
@@ -0,0 +1,84 @@
+package lokaldb
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestEnqueue(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		id  string
+		ids []string
+		b   []byte
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 12; i++ {
+		if id, err = db.Enqueue(`outbound`, []byte{byte(i)}); err != nil {
+			t.Fatalf("enqueue: %s", err)
+		}
+		if len(ids) > 0 && id <= ids[len(ids)-1] {
+			t.Fatalf("enqueue: id %s is not after %s", id, ids[len(ids)-1])
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] != `00000000000000000001` {
+		t.Fatalf("enqueue: first id %s", ids[0])
+	}
+
+	if b, err = db.Fetch(`outbound`, ids[5]); err != nil || len(b) != 1 || b[0] != 5 {
+		t.Fatalf("fetch: got %v, %v", b, err)
+	}
+	if err = db.Delete(`outbound`, ids[0]); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if b, err = db.FetchDelete(`outbound`, ids[11]); err != nil || b[0] != 11 {
+		t.Fatalf("fetch delete: got %v, %v", b, err)
+	}
+
+	// Ids are not reused after records are removed
+	if _, err = db.CutChunkDown(`outbound`, 0); err != nil {
+		t.Fatalf("cut chunk down: %s", err)
+	}
+	if id, err = db.Enqueue(`outbound`, []byte(`again`)); err != nil || id != `00000000000000000013` {
+		t.Fatalf("enqueue after cut: got %s, %v", id, err)
+	}
+}
+
+func TestUUIDv7(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		id  string
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`), WithIDGenerator(NewUUIDv7()))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	prev := ``
+	for i := 0; i < 1000; i++ {
+		if id, err = db.Enqueue(`outbound`, []byte(`data`)); err != nil {
+			t.Fatalf("enqueue: %s", err)
+		}
+		if !re.MatchString(id) {
+			t.Fatalf("enqueue: %s is not a version 7 UUID", id)
+		}
+		if id <= prev {
+			t.Fatalf("enqueue: id %s is not after %s", id, prev)
+		}
+		prev = id
+	}
+}
@@ -0,0 +1,439 @@
+package lokaldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// IndexFunc extracts the values a record is indexed with. A record can have no value or many values.
+type IndexFunc func(kv ChunkData) []string
+
+// A secondary index defined on a bucket
+type index struct {
+	name string
+	fn   IndexFunc
+}
+
+// Name of the bucket inside the internal bucket that keeps the entries of the secondary indexes
+var recIdxBucket []byte = []byte(`Qx4BOuPhw0MZOqSCJNVi`)
+
+// Names of the buckets of an index with its entries by value and the values of each key
+var (
+	idxValBucket = []byte(`v`)
+	idxKeyBucket = []byte(`k`)
+)
+
+// Values of a key in an index and the position they were indexed at
+type indexRecord struct {
+	Idx    int      `json:"i"`
+	Values []string `json:"v"`
+}
+
+// IndexHeader indexes records by the values of a header of their envelope
+func IndexHeader(header string) IndexFunc {
+	return func(kv ChunkData) []string {
+		return kv.Headers[header]
+	}
+}
+
+// DefineIndex defines a secondary index on the bucket. The index is built from the records of the bucket
+// in one transaction and is kept up to date by every operation that stores or removes records afterwards.
+//
+// Index functions are not stored in the database, so indexes must be defined again every time the
+// database is opened. Defining an index again with the same name replaces it and rebuilds it.
+//
+//	err = db.DefineIndex(`outbound`, `customer`, lokaldb.IndexHeader(`Customer-Id`))
+func (db *LokalDB) DefineIndex(bucket string, name string, fn IndexFunc) error {
+	return db.DefineIndexCtx(context.Background(), bucket, name, fn)
+}
+
+// DefineIndexCtx is DefineIndex with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) DefineIndexCtx(ctx context.Context, bucket string, name string, fn IndexFunc) error {
+
+	var (
+		old     []index
+		changed bool
+	)
+
+	if name == `` || fn == nil {
+		return ErrInvalidIndex
+	}
+
+	x := index{name: name, fn: fn}
+	err := db.UpdateCtx(ctx, func(tx *Tx) error {
+
+		if err := tx.buildIndex(bucket, x); err != nil {
+			return err
+		}
+
+		// Stores of other transactions use the index as soon as this one is committed
+		old, changed = db.setIndexes(bucket, append(withoutIndex(db.bucketIndexes(bucket), name), x)), true
+		return nil
+	})
+	if err != nil && changed {
+		db.setIndexes(bucket, old)
+	}
+
+	return err
+}
+
+// DropIndex removes the secondary index from the bucket with its entries
+func (db *LokalDB) DropIndex(bucket string, name string) error {
+	return db.DropIndexCtx(context.Background(), bucket, name)
+}
+
+// DropIndexCtx is DropIndex with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) DropIndexCtx(ctx context.Context, bucket string, name string) error {
+
+	var (
+		old     []index
+		changed bool
+	)
+
+	err := db.UpdateCtx(ctx, func(tx *Tx) error {
+
+		_, inb, err := tx.writable(bucket)
+		if err != nil {
+			return err
+		}
+
+		if inb != nil {
+			if xr := inb.Bucket(recIdxBucket); xr != nil && xr.Bucket([]byte(name)) != nil {
+				if err = xr.DeleteBucket([]byte(name)); err != nil {
+					return err
+				}
+			}
+		}
+
+		old, changed = db.setIndexes(bucket, withoutIndex(db.bucketIndexes(bucket), name)), true
+		return nil
+	})
+	if err != nil && changed {
+		db.setIndexes(bucket, old)
+	}
+
+	return err
+}
+
+// FindBy gets the records of the bucket with the value in the index, in the order they are in the bucket
+func (db *LokalDB) FindBy(bucket string, index string, value string) ([]ChunkData, error) {
+	return db.FindByCtx(context.Background(), bucket, index, value)
+}
+
+// FindByCtx is FindBy with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FindByCtx(ctx context.Context, bucket string, index string, value string) (chunk []ChunkData, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		chunk, err = tx.FindBy(bucket, index, value)
+		return
+	})
+	if err != nil {
+		return []ChunkData{}, err
+	}
+	return
+}
+
+// FindByPrefix gets the records of the bucket with a value in the index that starts with the prefix,
+// ordered by value and then by their order in the bucket
+func (db *LokalDB) FindByPrefix(bucket string, index string, prefix string) ([]ChunkData, error) {
+	return db.FindByPrefixCtx(context.Background(), bucket, index, prefix)
+}
+
+// FindByPrefixCtx is FindByPrefix with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FindByPrefixCtx(ctx context.Context, bucket string, index string, prefix string) (chunk []ChunkData, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		chunk, err = tx.FindByPrefix(bucket, index, prefix)
+		return
+	})
+	if err != nil {
+		return []ChunkData{}, err
+	}
+	return
+}
+
+// FindBy gets the records of the bucket with the value in the index, in the order they are in the bucket
+func (tx *Tx) FindBy(bucket string, index string, value string) ([]ChunkData, error) {
+	return tx.find(bucket, index, []byte(value+"\x00"))
+}
+
+// FindByPrefix gets the records of the bucket with a value in the index that starts with the prefix
+func (tx *Tx) FindByPrefix(bucket string, index string, prefix string) ([]ChunkData, error) {
+	return tx.find(bucket, index, []byte(prefix))
+}
+
+// Get the records with index entries starting with the prefix
+func (tx *Tx) find(bucket string, name string, prefix []byte) ([]ChunkData, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		chunk  = make([]ChunkData, 0)
+		found  bool
+	)
+
+	for _, x := range tx.indexes(bucket) {
+		found = found || x.name == name
+	}
+	if !found {
+		return []ChunkData{}, ErrIndexNotFound
+	}
+
+	if b, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return chunk, err
+	}
+
+	vb := indexBucket(inb, name, idxValBucket)
+	if vb == nil {
+		return chunk, nil
+	}
+
+	now := tx.now()
+	c := vb.Cursor()
+	for k, keyb := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, keyb = c.Next() {
+		if err = tx.ctx.Err(); err != nil {
+			return []ChunkData{}, err
+		}
+		if expired(inb, keyb, now) {
+			continue
+		}
+		chunk = append(chunk, record(b, inb, keyb, getint(inb, keyb)))
+	}
+
+	return chunk, nil
+}
+
+// Get the indexes defined on the bucket
+func (tx *Tx) indexes(bucket string) []index {
+
+	if tx.db == nil {
+		return nil
+	}
+
+	return tx.db.bucketIndexes(bucket)
+}
+
+// Get the indexes defined on the bucket
+func (db *LokalDB) bucketIndexes(bucket string) []index {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.indexes[bucket]
+}
+
+// Replace the indexes defined on the bucket and return the previous ones.
+// Slices of indexes are never modified once set, so transactions can keep using the ones they got.
+func (db *LokalDB) setIndexes(bucket string, ix []index) []index {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.indexes == nil {
+		db.indexes = make(map[string][]index)
+	}
+
+	old := db.indexes[bucket]
+	db.indexes[bucket] = ix
+
+	return old
+}
+
+// Move the indexes defined on the bucket and the buckets under it to the new path. An empty path removes them.
+func (db *LokalDB) moveIndexes(bucket string, newName string) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	moved := make(map[string][]index)
+	for path, ix := range db.indexes {
+		if path == bucket || strings.HasPrefix(path, bucket+PathSeparator) {
+			moved[path[len(bucket):]] = ix
+			delete(db.indexes, path)
+		}
+	}
+
+	if newName == `` {
+		return
+	}
+
+	for rest, ix := range moved {
+		db.indexes[newName+rest] = ix
+	}
+}
+
+// Copy the indexes without the one with the name
+func withoutIndex(ix []index, name string) []index {
+
+	cp := make([]index, 0, len(ix))
+	for _, x := range ix {
+		if x.name != name {
+			cp = append(cp, x)
+		}
+	}
+
+	return cp
+}
+
+// Build an index from the records of the bucket
+func (tx *Tx) buildIndex(bucket string, x index) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		xr     *bolt.Bucket
+	)
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	if xr, err = inb.CreateBucketIfNotExists(recIdxBucket); err != nil {
+		return err
+	}
+	if xr.Bucket([]byte(x.name)) != nil {
+		if err = xr.DeleteBucket([]byte(x.name)); err != nil {
+			return err
+		}
+	}
+	if _, err = xr.CreateBucket([]byte(x.name)); err != nil {
+		return err
+	}
+
+	walk(inb, -1, true, func(idx int, keyb []byte) bool {
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+		err = addIndex(inb, x, record(b, inb, keyb, idx), idx)
+		return err == nil
+	})
+
+	return err
+}
+
+// Get a bucket of an index. It is nil if the index was never built.
+func indexBucket(inb *bolt.Bucket, name string, sub []byte) *bolt.Bucket {
+
+	xr := inb.Bucket(recIdxBucket)
+	if xr == nil {
+		return nil
+	}
+
+	xb := xr.Bucket([]byte(name))
+	if xb == nil {
+		return nil
+	}
+
+	return xb.Bucket(sub)
+}
+
+// Index a stored record with the indexes of its bucket
+func reindex(b, inb *bolt.Bucket, ix []index, key []byte) error {
+
+	if err := unindex(inb, key); err != nil {
+		return err
+	}
+	if len(ix) == 0 {
+		return nil
+	}
+
+	idx := getint(inb, key)
+	kv := record(b, inb, key, idx)
+	for _, x := range ix {
+		if err := addIndex(inb, x, kv, idx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add the entries of a record to an index
+func addIndex(inb *bolt.Bucket, x index, kv ChunkData, idx int) error {
+
+	var (
+		err    error
+		xr, xb *bolt.Bucket
+		vb, kb *bolt.Bucket
+		ir     = indexRecord{Idx: idx}
+		v      []byte
+	)
+
+	for _, val := range x.fn(kv) {
+		if val != `` {
+			ir.Values = append(ir.Values, val)
+		}
+	}
+	if len(ir.Values) == 0 {
+		return nil
+	}
+
+	if xr, err = inb.CreateBucketIfNotExists(recIdxBucket); err != nil {
+		return err
+	}
+	if xb, err = xr.CreateBucketIfNotExists([]byte(x.name)); err != nil {
+		return err
+	}
+	if vb, err = xb.CreateBucketIfNotExists(idxValBucket); err != nil {
+		return err
+	}
+	if kb, err = xb.CreateBucketIfNotExists(idxKeyBucket); err != nil {
+		return err
+	}
+
+	for _, val := range ir.Values {
+		if err = vb.Put(indexEntry(val, idx), []byte(kv.Key)); err != nil {
+			return err
+		}
+	}
+
+	if v, err = json.Marshal(ir); err != nil {
+		return err
+	}
+
+	return kb.Put([]byte(kv.Key), v)
+}
+
+// Remove the entries of a key from all the indexes of its bucket
+func unindex(inb *bolt.Bucket, key []byte) error {
+
+	xr := inb.Bucket(recIdxBucket)
+	if xr == nil {
+		return nil
+	}
+
+	return xr.ForEachBucket(func(name []byte) error {
+
+		var ir indexRecord
+
+		xb := xr.Bucket(name)
+		kb, vb := xb.Bucket(idxKeyBucket), xb.Bucket(idxValBucket)
+		if kb == nil || vb == nil {
+			return nil
+		}
+
+		v := kb.Get(key)
+		if v == nil {
+			return nil
+		}
+		if err := json.Unmarshal(v, &ir); err != nil {
+			return err
+		}
+
+		for _, val := range ir.Values {
+			if err := vb.Delete(indexEntry(val, ir.Idx)); err != nil {
+				return err
+			}
+		}
+
+		return kb.Delete(key)
+	})
+}
+
+// Key of an index entry. Entries of a value are in the order of the records in the bucket.
+func indexEntry(value string, idx int) []byte {
+	return []byte(fmt.Sprintf("%s\x00%020d", value, idx))
+}
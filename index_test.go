@@ -0,0 +1,234 @@
+package lokaldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecondaryIndexes(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	store := func(key, customer, subject string) {
+		err := db.StoreRecord(`outbound`, ChunkData{
+			Key:      key,
+			Value:    []byte(key),
+			Envelope: Envelope{Headers: map[string][]string{`Customer`: {customer}, `Subject`: {subject}}},
+		})
+		if err != nil {
+			t.Fatalf("store record %s: %s", key, err)
+		}
+	}
+
+	// Records stored before the index is defined are indexed too
+	store(`m01`, `acme`, `orders.created`)
+	store(`m02`, `globex`, `orders.created`)
+
+	if err = db.DefineIndex(`outbound`, `customer`, IndexHeader(`Customer`)); err != nil {
+		t.Fatalf("define index: %s", err)
+	}
+	err = db.DefineIndex(`outbound`, `subject`, func(kv ChunkData) []string {
+		return kv.Headers[`Subject`]
+	})
+	if err != nil {
+		t.Fatalf("define index: %s", err)
+	}
+
+	store(`m03`, `acme`, `orders.shipped`)
+	store(`m04`, `initech`, `invoices.sent`)
+	store(`m05`, `acme`, `invoices.sent`)
+
+	if chunk, err = db.FindBy(`outbound`, `customer`, `acme`); err != nil || keysOf(chunk) != `m01 m03 m05 ` {
+		t.Fatalf("find by customer: got %s, %v", keysOf(chunk), err)
+	}
+	if chunk, err = db.FindByPrefix(`outbound`, `subject`, `orders.`); err != nil || keysOf(chunk) != `m01 m02 m03 ` {
+		t.Fatalf("find by subject prefix: got %s, %v", keysOf(chunk), err)
+	}
+	if chunk[0].Headers[`Customer`][0] != `acme` {
+		t.Fatalf("find by subject prefix: got envelope %+v", chunk[0].Envelope)
+	}
+
+	// A changed header moves the record to the other value
+	store(`m03`, `globex`, `orders.shipped`)
+	if chunk, _ = db.FindBy(`outbound`, `customer`, `globex`); keysOf(chunk) != `m02 m03 ` {
+		t.Fatalf("find by customer after update: got %s", keysOf(chunk))
+	}
+
+	// Removals in the same transaction as the index
+	if err = db.Delete(`outbound`, `m05`); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if _, err = db.SliceDown(`outbound`); err != nil {
+		t.Fatalf("slice down: %s", err)
+	}
+	if chunk, _ = db.FindBy(`outbound`, `customer`, `acme`); keysOf(chunk) != `` {
+		t.Fatalf("find by customer after removals: got %s", keysOf(chunk))
+	}
+	if _, err = db.CutChunkUp(`outbound`, 1); err != nil {
+		t.Fatalf("cut chunk up: %s", err)
+	}
+	if chunk, _ = db.FindBy(`outbound`, `subject`, `invoices.sent`); keysOf(chunk) != `` {
+		t.Fatalf("find by subject after cut: got %s", keysOf(chunk))
+	}
+
+	// A rolled back store leaves the index untouched
+	errAbort := errors.New(`abort`)
+	err = db.Update(func(tx *Tx) error {
+		if err := tx.StoreRecord(`outbound`, ChunkData{Key: `m06`, Envelope: Envelope{Headers: map[string][]string{`Customer`: {`acme`}}}}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("update: got %v, want %v", err, errAbort)
+	}
+	if chunk, _ = db.FindBy(`outbound`, `customer`, `acme`); keysOf(chunk) != `` {
+		t.Fatalf("find by customer after rollback: got %s", keysOf(chunk))
+	}
+
+	if err = db.PurgeBucket(`outbound`); err != nil {
+		t.Fatalf("purge: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		store(fmt.Sprintf("p%02d", i), `acme`, `orders.created`)
+	}
+	if chunk, _ = db.FindBy(`outbound`, `customer`, `acme`); len(chunk) != 10 || !strings.HasPrefix(keysOf(chunk), `p00 p01`) {
+		t.Fatalf("find by customer after purge: got %s", keysOf(chunk))
+	}
+
+	if err = db.DropIndex(`outbound`, `customer`); err != nil {
+		t.Fatalf("drop index: %s", err)
+	}
+	if _, err = db.FindBy(`outbound`, `customer`, `acme`); !errors.Is(err, ErrIndexNotFound) {
+		t.Fatalf("find by dropped index: got %v, want %v", err, ErrIndexNotFound)
+	}
+}
+
+func TestIndexBuckets(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+		eu    = Path(`outbound`, `eu`)
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for _, bucket := range []string{`outbound`, eu} {
+		if err = db.Store(bucket, `m01`, []byte(`acme`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+		if err = db.DefineIndex(bucket, `value`, func(kv ChunkData) []string { return []string{string(kv.Value)} }); err != nil {
+			t.Fatalf("define index: %s", err)
+		}
+	}
+
+	// Indexes move with the bucket and the buckets under it
+	if err = db.RenameBucket(`outbound`, `archive`); err != nil {
+		t.Fatalf("rename bucket: %s", err)
+	}
+	if err = db.Store(`archive`, `m02`, []byte(`acme`)); err != nil {
+		t.Fatalf("store renamed: %s", err)
+	}
+	if chunk, err = db.FindBy(`archive`, `value`, `acme`); err != nil || keysOf(chunk) != `m01 m02 ` {
+		t.Fatalf("find by renamed: got %s, %v, want m01 m02", keysOf(chunk), err)
+	}
+	if chunk, err = db.FindBy(Path(`archive`, `eu`), `value`, `acme`); err != nil || keysOf(chunk) != `m01 ` {
+		t.Fatalf("find by renamed child: got %s, %v, want m01", keysOf(chunk), err)
+	}
+
+	// A new bucket with the old name does not get them
+	if err = db.Store(`outbound`, `m01`, []byte(`acme`)); err != nil {
+		t.Fatalf("store old name: %s", err)
+	}
+	if _, err = db.FindBy(`outbound`, `value`, `acme`); !errors.Is(err, ErrIndexNotFound) {
+		t.Fatalf("find by old name: got %v, want %v", err, ErrIndexNotFound)
+	}
+
+	// Dropped buckets lose their indexes
+	if err = db.DropBucket(`archive`); err != nil {
+		t.Fatalf("drop bucket: %s", err)
+	}
+	for _, bucket := range []string{`archive`, Path(`archive`, `eu`)} {
+		if err = db.Store(bucket, `m01`, []byte(`acme`)); err != nil {
+			t.Fatalf("store dropped: %s", err)
+		}
+		if _, err = db.FindBy(bucket, `value`, `acme`); !errors.Is(err, ErrIndexNotFound) {
+			t.Fatalf("find by dropped %q: got %v, want %v", bucket, err, ErrIndexNotFound)
+		}
+	}
+}
+
+func TestIndexEmpty(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	// Defining an index creates the bucket without records
+	if err = db.DefineIndex(`z`, `customer`, IndexHeader(`Customer`)); err != nil {
+		t.Fatalf("define index: %s", err)
+	}
+	checkEmpty(t, db, `z`)
+}
+
+func TestIndexContext(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for _, key := range []string{`m01`, `m02`} {
+		if err = db.StoreRecord(`outbound`, ChunkData{Key: key, Envelope: Envelope{Headers: map[string][]string{`Customer`: {`acme`}}}}); err != nil {
+			t.Fatalf("store record: %s", err)
+		}
+	}
+
+	// A context done in the middle of the build leaves the index undefined
+	ctx, cancel := context.WithCancel(context.Background())
+	err = db.DefineIndexCtx(ctx, `outbound`, `customer`, func(kv ChunkData) []string {
+		cancel()
+		return kv.Headers[`Customer`]
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("define index: got %v, want %v", err, context.Canceled)
+	}
+	if _, err = db.FindBy(`outbound`, `customer`, `acme`); !errors.Is(err, ErrIndexNotFound) {
+		t.Fatalf("find by cancelled index: got %v, want %v", err, ErrIndexNotFound)
+	}
+
+	if err = db.DefineIndexCtx(context.Background(), `outbound`, `customer`, IndexHeader(`Customer`)); err != nil {
+		t.Fatalf("define index: %s", err)
+	}
+	if err = db.DropIndexCtx(ctx, `outbound`, `customer`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("drop index: got %v, want %v", err, context.Canceled)
+	}
+	if chunk, err = db.FindBy(`outbound`, `customer`, `acme`); err != nil || keysOf(chunk) != `m01 m02 ` {
+		t.Fatalf("find by after cancelled drop: got %s, %v, want m01 m02", keysOf(chunk), err)
+	}
+}
@@ -0,0 +1,112 @@
+package lokaldb
+
+import (
+	"iter"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Number of records read by an iterator in one read-only transaction
+const iterPageSize = 256
+
+// All returns an iterator over the records of the bucket from top to bottom (FIFO).
+//
+// Records are read in pages of a few hundred in short read-only transactions, so memory stays
+// bounded and the loop body can modify the database. Records stored after the iteration started
+// may or may not be yielded. A missing bucket yields nothing.
+//
+//	for key, value := range db.All(`outbound`) {
+//		if err := publish(key, value); err != nil {
+//			break
+//		}
+//	}
+func (db *LokalDB) All(bucket string) iter.Seq2[string, []byte] {
+	return db.seq(bucket, nil, true)
+}
+
+// Backward returns an iterator over the records of the bucket from bottom to top (LIFO).
+func (db *LokalDB) Backward(bucket string) iter.Seq2[string, []byte] {
+	return db.seq(bucket, nil, false)
+}
+
+// From returns an iterator over the records of the bucket from top to bottom (FIFO),
+// starting at the record with the provided key. If the key does not exist, nothing is yielded.
+func (db *LokalDB) From(bucket string, key string) iter.Seq2[string, []byte] {
+	return db.seq(bucket, &key, true)
+}
+
+// Iterate over the records of the bucket, one page per read-only transaction
+func (db *LokalDB) seq(bucket string, from *string, forward bool) iter.Seq2[string, []byte] {
+	return func(yield func(string, []byte) bool) {
+
+		var (
+			err     error
+			chunk   []ChunkData
+			idx     = -1
+			more    bool
+			started bool
+		)
+
+		for {
+			err = db.View(func(tx *Tx) error {
+
+				b, inb, err := tx.bucket(bucket)
+				if err != nil || inb == nil {
+					return err
+				}
+
+				// Locate the record to start from
+				if !started && from != nil {
+					if idx = getint(inb, []byte(*from)); idx == 0 {
+						return nil
+					}
+				}
+
+				chunk, idx, more = page(b, inb, idx, forward, iterPageSize, tx.now())
+				return nil
+			})
+			if err != nil {
+				return
+			}
+			started = true
+
+			for _, kv := range chunk {
+				if !yield(kv.Key, kv.Value) {
+					return
+				}
+			}
+
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+// Read a page of up to max records starting at the index. A negative index starts at the
+// first record (forward) or the last record (backward). It returns the index to continue from and whether there are more
+// records after the page. Records that have expired at the time are skipped.
+func page(b, inb *bolt.Bucket, idx int, forward bool, max int, now time.Time) ([]ChunkData, int, bool) {
+
+	var (
+		more  bool
+		chunk = make([]ChunkData, 0, max)
+	)
+
+	live(inb, idx, forward, now, func(i int, keyb []byte) bool {
+		if len(chunk) == max {
+			idx, more = i, true
+			return false
+		}
+		chunk = append(chunk, record(b, inb, keyb, i))
+		if forward {
+			idx = i + 1
+		} else {
+			idx = i - 1
+		}
+		return true
+	})
+
+	return chunk, idx, more
+}
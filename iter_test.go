@@ -0,0 +1,92 @@
+package lokaldb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestIterators(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		cnt int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	kv := make([]ChunkData, 0, 600)
+	for i := 0; i < 600; i++ {
+		kv = append(kv, ChunkData{Key: fmt.Sprintf("msg-%03d", i), Value: []byte(fmt.Sprintf("%d", i))})
+	}
+	if err = db.StoreOnce(`default`, kv); err != nil {
+		t.Fatalf("store once: %s", err)
+	}
+
+	// Leave a few gaps in the index
+	if err = db.DeleteOnce(`default`, []string{`msg-000`, `msg-255`, `msg-256`, `msg-599`}); err != nil {
+		t.Fatalf("delete once: %s", err)
+	}
+
+	prev := ``
+	cnt = 0
+	for key, value := range db.All(`default`) {
+		if key <= prev {
+			t.Fatalf("all: %s yielded after %s", key, prev)
+		}
+		if want := fmt.Sprintf("msg-%03s", value); key != want {
+			t.Fatalf("all: value %s yielded for %s", value, key)
+		}
+		prev = key
+		cnt++
+	}
+	if cnt != 596 {
+		t.Fatalf("all: got %d records, want 596", cnt)
+	}
+
+	prev = `~`
+	cnt = 0
+	for key := range db.Backward(`default`) {
+		if key >= prev {
+			t.Fatalf("backward: %s yielded after %s", key, prev)
+		}
+		prev = key
+		cnt++
+	}
+	if cnt != 596 {
+		t.Fatalf("backward: got %d records, want 596", cnt)
+	}
+
+	cnt = 0
+	for key := range db.From(`default`, `msg-500`) {
+		if cnt == 0 && key != `msg-500` {
+			t.Fatalf("from: first key %s, want msg-500", key)
+		}
+		cnt++
+	}
+	if cnt != 99 {
+		t.Fatalf("from: got %d records, want 99", cnt)
+	}
+
+	// The loop body can modify the database and break early
+	cnt = 0
+	for key := range db.All(`default`) {
+		if err = db.Delete(`default`, key); err != nil {
+			t.Fatalf("delete: %s", err)
+		}
+		if cnt++; cnt == 300 {
+			break
+		}
+	}
+	if cnt, _ = db.Count(`default`); cnt != 296 {
+		t.Fatalf("count: got %d, want 296", cnt)
+	}
+
+	for range db.All(`missing`) {
+		t.Fatal(`all: missing bucket yielded a record`)
+	}
+}
@@ -0,0 +1,356 @@
+package lokaldb
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Lease is a set of records reserved by a consumer. The records stay in the bucket, hidden from
+// other consumers, until they are acknowledged, released or the lease expires.
+type Lease struct {
+	ID      string      // Identifier to pass to Ack and Nack. It is empty if no record was reserved
+	Bucket  string      // Bucket of the records
+	Expires time.Time   // Time the records become visible again if they are not acknowledged
+	Records []ChunkData // Reserved records in the order they were in the bucket
+}
+
+// Name of the bucket inside the internal bucket that keeps the leases of the records
+var recLeaseBucket []byte = []byte(`KFJpKp4mSxieBPO9DyaU`)
+
+// Names of the buckets with the lease of each key and the keys of each lease
+var (
+	leaseKeyBucket = []byte(`k`)
+	leaseIDBucket  = []byte(`l`)
+)
+
+// Reserve hides up to n records from the top of the bucket behind a new lease for the visibility timeout,
+// and returns them. The delivery attempts of the records are increased. Records reserved by another lease
+// that has not expired are skipped. Records of expired leases that were released too many times are moved
+// to the dead-letter bucket instead, if the bucket has one.
+//
+// Leases are stored with the records, so the records of a consumer that crashed become visible again at
+// their original position when its leases expire, even after the database is opened again.
+//
+//	lease, err := db.Reserve(`outbound`, 100, 30*time.Second)
+//	for _, kv := range lease.Records {
+//		if err := publish(kv); err != nil {
+//			db.Nack(lease.ID, kv.Key)
+//			continue
+//		}
+//		db.Ack(lease.ID, kv.Key)
+//	}
+func (db *LokalDB) Reserve(bucket string, n int, visibilityTimeout time.Duration) (Lease, error) {
+	return db.ReserveCtx(context.Background(), bucket, n, visibilityTimeout)
+}
+
+// ReserveCtx is Reserve with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) ReserveCtx(ctx context.Context, bucket string, n int, visibilityTimeout time.Duration) (lease Lease, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		lease, err = tx.Reserve(bucket, n, visibilityTimeout)
+		return
+	})
+	if err != nil {
+		return Lease{Records: []ChunkData{}}, err
+	}
+	return
+}
+
+// Ack removes the records of the lease with the keys. Without keys, all the records of the lease are removed.
+// If a key is not reserved by the lease anymore, nothing is removed and ErrLeaseNotFound is returned.
+func (db *LokalDB) Ack(leaseID string, keys ...string) error {
+	return db.AckCtx(context.Background(), leaseID, keys...)
+}
+
+// AckCtx is Ack with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) AckCtx(ctx context.Context, leaseID string, keys ...string) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.Ack(leaseID, keys...)
+	})
+}
+
+// Nack releases the records of the lease with the keys so that they are visible again at their position.
+// Without keys, all the records of the lease are released. If a key is not reserved by the lease anymore,
+// nothing is released and ErrLeaseNotFound is returned. Records released too many times are moved to the
+// dead-letter bucket, if the bucket has one.
+func (db *LokalDB) Nack(leaseID string, keys ...string) error {
+	return db.NackCtx(context.Background(), leaseID, keys...)
+}
+
+// NackCtx is Nack with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) NackCtx(ctx context.Context, leaseID string, keys ...string) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.Nack(leaseID, keys...)
+	})
+}
+
+// Reserve hides up to n records from the top of the bucket behind a new lease for the visibility timeout
+func (tx *Tx) Reserve(bucket string, n int, visibilityTimeout time.Duration) (Lease, error) {
+
+	var (
+		err     error
+		b, inb  *bolt.Bucket
+		lb      *bolt.Bucket
+		id      string
+		keys    [][]byte
+		dead    [][]byte
+		expires time.Time
+		lease   = Lease{Bucket: bucket, Records: []ChunkData{}}
+	)
+
+	if n <= 0 {
+		return lease, ErrInvalidLimit
+	}
+	if visibilityTimeout <= 0 {
+		return lease, ErrInvalidTimeout
+	}
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return lease, err
+	}
+
+	now := tx.now()
+	ready(inb, -1, true, now, func(idx int, keyb []byte) bool {
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+		// A record of an expired lease has been released
+		if id, _ := holder(inb, keyb); id != `` && exhausted(inb, keyb) {
+			dead = append(dead, keyb)
+			return true
+		}
+		keys = append(keys, keyb)
+		return len(keys) < n
+	})
+	if err != nil {
+		return lease, err
+	}
+
+	for _, keyb := range dead {
+		if err = tx.deadLetter(bucket, b, inb, keyb, ReasonLeaseExpired); err != nil {
+			return lease, err
+		}
+	}
+	if len(keys) == 0 {
+		return lease, nil
+	}
+
+	if id, err = newLeaseID(bucket); err != nil {
+		return lease, err
+	}
+	if lb, err = inb.CreateBucketIfNotExists(recLeaseBucket); err != nil {
+		return lease, err
+	}
+
+	expires = now.Add(visibilityTimeout)
+	for _, keyb := range keys {
+
+		// An expired lease of the record is replaced
+		if err = release(inb, keyb); err != nil {
+			return lease, err
+		}
+		if err = hold(lb, id, keyb, expires); err != nil {
+			return lease, err
+		}
+
+		env := envelope(inb, keyb)
+		env.Attempts++
+		if err = putEnvelope(inb, keyb, env); err != nil {
+			return lease, err
+		}
+
+		lease.Records = append(lease.Records, record(b, inb, keyb, getint(inb, keyb)))
+	}
+
+	lease.ID, lease.Expires = id, expires
+
+	return lease, nil
+}
+
+// Ack removes the records of the lease with the keys. Without keys, all the records of the lease are removed.
+func (tx *Tx) Ack(leaseID string, keys ...string) error {
+
+	b, inb, held, err := tx.leased(leaseID, keys)
+	if err != nil {
+		return err
+	}
+
+	return remove(b, inb, held...)
+}
+
+// Nack releases the records of the lease with the keys. Without keys, all the records of the lease are released.
+func (tx *Tx) Nack(leaseID string, keys ...string) error {
+
+	return tx.NackWithReason(leaseID, ``, keys...)
+}
+
+// Get the bucket of a lease and the keys it holds. Without keys, all the keys of the lease are returned.
+// Keys that are not held by the lease return ErrLeaseNotFound.
+func (tx *Tx) leased(leaseID string, keys []string) (b, inb *bolt.Bucket, held [][]byte, err error) {
+
+	var (
+		bucket string
+		lb     *bolt.Bucket
+	)
+
+	if bucket, err = leaseBucket(leaseID); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if b, inb, err = tx.writable(bucket); err != nil {
+		if err == ErrBucketDoesNotExist {
+			err = ErrLeaseNotFound
+		}
+		return nil, nil, nil, err
+	}
+
+	if inb == nil {
+		return nil, nil, nil, ErrLeaseNotFound
+	}
+	if lb = inb.Bucket(recLeaseBucket); lb == nil {
+		return nil, nil, nil, ErrLeaseNotFound
+	}
+
+	if len(keys) == 0 {
+		prefix := []byte(leaseID + "\x00")
+		c := lb.Bucket(leaseIDBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			held = append(held, bytes.Clone(k[len(prefix):]))
+		}
+		if len(held) == 0 {
+			return nil, nil, nil, ErrLeaseNotFound
+		}
+		return b, inb, held, nil
+	}
+
+	for _, key := range keys {
+		if id, _ := holder(inb, []byte(key)); id != leaseID {
+			return nil, nil, nil, ErrLeaseNotFound
+		}
+		held = append(held, []byte(key))
+	}
+
+	return b, inb, held, nil
+}
+
+// Get the time of the clock of the database
+func (tx *Tx) now() time.Time {
+
+	if tx.db == nil || tx.db.now == nil {
+		return time.Now()
+	}
+
+	return tx.db.now()
+}
+
+// Create a lease identifier. The bucket is kept in the identifier so that Ack and Nack can find it.
+func newLeaseID(bucket string) (string, error) {
+
+	var rnd [12]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return ``, err
+	}
+
+	return hex.EncodeToString(rnd[:]) + `.` + base64.RawURLEncoding.EncodeToString([]byte(bucket)), nil
+}
+
+// Get the bucket of a lease from its identifier
+func leaseBucket(leaseID string) (string, error) {
+
+	_, enc, ok := strings.Cut(leaseID, `.`)
+	if !ok {
+		return ``, ErrLeaseNotFound
+	}
+
+	bucket, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil || len(bucket) == 0 {
+		return ``, ErrLeaseNotFound
+	}
+
+	return string(bucket), nil
+}
+
+// Reserve a key for a lease until it expires
+func hold(lb *bolt.Bucket, leaseID string, key []byte, expires time.Time) error {
+
+	kb, err := lb.CreateBucketIfNotExists(leaseKeyBucket)
+	if err != nil {
+		return err
+	}
+	ib, err := lb.CreateBucketIfNotExists(leaseIDBucket)
+	if err != nil {
+		return err
+	}
+
+	if err = kb.Put(key, []byte(leaseID+"\x00"+strconv.FormatInt(expires.UnixNano(), 10))); err != nil {
+		return err
+	}
+
+	return ib.Put(append([]byte(leaseID+"\x00"), key...), []byte{})
+}
+
+// Get the lease of a key and the time it expires. The lease is empty if the key is not reserved.
+func holder(inb *bolt.Bucket, key []byte) (string, time.Time) {
+
+	lb := inb.Bucket(recLeaseBucket)
+	if lb == nil || lb.Bucket(leaseKeyBucket) == nil {
+		return ``, time.Time{}
+	}
+
+	v := lb.Bucket(leaseKeyBucket).Get(key)
+	if v == nil {
+		return ``, time.Time{}
+	}
+
+	id, exp, _ := strings.Cut(string(v), "\x00")
+	ns, _ := strconv.ParseInt(exp, 10, 64)
+
+	return id, time.Unix(0, ns)
+}
+
+// Check if a key is reserved by a lease that has not expired
+func leased(inb *bolt.Bucket, key []byte, now time.Time) bool {
+	id, expires := holder(inb, key)
+	return id != `` && now.Before(expires)
+}
+
+// Check if a record of the bucket is reserved by a lease that has not expired
+func reserving(inb *bolt.Bucket, now time.Time) bool {
+
+	lb := inb.Bucket(recLeaseBucket)
+	if lb == nil || lb.Bucket(leaseKeyBucket) == nil {
+		return false
+	}
+
+	c := lb.Bucket(leaseKeyBucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if leased(inb, k, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Release the lease of a key, if there is one
+func release(inb *bolt.Bucket, key []byte) error {
+
+	id, _ := holder(inb, key)
+	if id == `` {
+		return nil
+	}
+
+	lb := inb.Bucket(recLeaseBucket)
+	if err := lb.Bucket(leaseKeyBucket).Delete(key); err != nil {
+		return err
+	}
+
+	return lb.Bucket(leaseIDBucket).Delete(append([]byte(id+"\x00"), key...))
+}
@@ -0,0 +1,258 @@
+package lokaldb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		lease Lease
+		other Lease
+		chunk []ChunkData
+		cnt   int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if _, err = db.Reserve(`default`, 0, time.Minute); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("reserve zero: got %v, want %v", err, ErrInvalidLimit)
+	}
+	if _, err = db.Reserve(`default`, 1, 0); !errors.Is(err, ErrInvalidTimeout) {
+		t.Fatalf("reserve without timeout: got %v, want %v", err, ErrInvalidTimeout)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("m%02d", i), []byte(fmt.Sprintf("%d", i))); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	if lease, err = db.Reserve(`default`, 2, time.Minute); err != nil || lease.ID == `` || keysOf(lease.Records) != `m01 m02 ` {
+		t.Fatalf("reserve: got %q %q %v, want m01 m02", lease.ID, keysOf(lease.Records), err)
+	}
+	if lease.Records[0].Attempts != 1 || string(lease.Records[0].Value) != `1` {
+		t.Fatalf("reserve attempts: got %d %q, want 1 \"1\"", lease.Records[0].Attempts, lease.Records[0].Value)
+	}
+
+	// Reserved records are hidden from other consumers but still counted
+	if other, err = db.Reserve(`default`, 2, time.Minute); err != nil || keysOf(other.Records) != `m03 m04 ` {
+		t.Fatalf("reserve other: got %q %v, want m03 m04", keysOf(other.Records), err)
+	}
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m05 ` {
+		t.Fatalf("fetch chunk down: got %q %v, want m05", keysOf(chunk), err)
+	}
+	if kv, ok, err := db.PeekHead(`default`); err != nil || !ok || kv.Key != `m05` {
+		t.Fatalf("peek head: got %q %v %v, want m05", kv.Key, ok, err)
+	}
+	if cnt, err = db.Count(`default`); err != nil || cnt != 5 {
+		t.Fatalf("count: got %d %v, want 5", cnt, err)
+	}
+
+	// A failed ack changes nothing
+	if err = db.Ack(lease.ID, `m01`, `m03`); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("ack foreign key: got %v, want %v", err, ErrLeaseNotFound)
+	}
+	if err = db.Ack(lease.ID, `m02`); err != nil {
+		t.Fatalf("ack: %s", err)
+	}
+	if err = db.Ack(lease.ID, `m02`); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("ack again: got %v, want %v", err, ErrLeaseNotFound)
+	}
+	if err = db.Nack(lease.ID); err != nil {
+		t.Fatalf("nack: %s", err)
+	}
+
+	// Released records are back at their position
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m01 m05 ` {
+		t.Fatalf("fetch chunk after nack: got %q %v, want m01 m05", keysOf(chunk), err)
+	}
+
+	if err = db.Ack(other.ID); err != nil {
+		t.Fatalf("ack all: %s", err)
+	}
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m01 m05 ` {
+		t.Fatalf("fetch chunk after ack: got %q %v, want m01 m05", keysOf(chunk), err)
+	}
+	if cnt, err = db.Count(`default`); err != nil || cnt != 2 {
+		t.Fatalf("count after ack: got %d %v, want 2", cnt, err)
+	}
+
+	if lease, err = db.Reserve(`default`, 5, time.Minute); err != nil || keysOf(lease.Records) != `m01 m05 ` || lease.Records[0].Attempts != 2 {
+		t.Fatalf("reserve again: got %q %v, want m01 m05", keysOf(lease.Records), err)
+	}
+	if other, err = db.Reserve(`default`, 5, time.Minute); err != nil || other.ID != `` || len(other.Records) != 0 {
+		t.Fatalf("reserve empty: got %q %d %v, want no lease", other.ID, len(other.Records), err)
+	}
+	if data, err := db.SliceDown(`default`); err != nil || data != nil {
+		t.Fatalf("slice down reserved: got %q %v, want nil", data, err)
+	}
+
+	for _, id := range []string{``, `x`, `x.!`, lease.ID + `x`} {
+		if err = db.Nack(id); !errors.Is(err, ErrLeaseNotFound) {
+			t.Fatalf("nack %q: got %v, want %v", id, err, ErrLeaseNotFound)
+		}
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		lease Lease
+		chunk []ChunkData
+		file  = filepath.Join(t.TempDir(), `test.db`)
+		now   = time.Now()
+	)
+
+	db, err = Open(file)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("m%02d", i), []byte(fmt.Sprintf("%d", i))); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	if lease, err = db.Reserve(`default`, 2, time.Minute); err != nil || keysOf(lease.Records) != `m01 m02 ` {
+		t.Fatalf("reserve: got %q %v, want m01 m02", keysOf(lease.Records), err)
+	}
+
+	// Leases survive a restart of the process
+	if err = db.Close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	if db, err = Open(file); err != nil {
+		t.Fatalf("reopen: %s", err)
+	}
+	defer db.Close()
+
+	if chunk, err = db.CutChunkDown(`default`, 0); err != nil || keysOf(chunk) != `m03 ` {
+		t.Fatalf("cut chunk down: got %q %v, want m03", keysOf(chunk), err)
+	}
+
+	db.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+	// Expired leases make the records visible at their original position
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m01 m02 ` {
+		t.Fatalf("fetch chunk after expiry: got %q %v, want m01 m02", keysOf(chunk), err)
+	}
+
+	// A record of an expired lease can still be acknowledged until it is reserved again
+	if err = db.Ack(lease.ID, `m02`); err != nil {
+		t.Fatalf("ack expired: %s", err)
+	}
+
+	other, err := db.Reserve(`default`, 1, time.Minute)
+	if err != nil || keysOf(other.Records) != `m01 ` || other.Records[0].Attempts != 2 {
+		t.Fatalf("reserve expired: got %q %v, want m01", keysOf(other.Records), err)
+	}
+	if err = db.Ack(lease.ID, `m01`); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("ack replaced lease: got %v, want %v", err, ErrLeaseNotFound)
+	}
+	if err = db.Ack(other.ID); err != nil {
+		t.Fatalf("ack: %s", err)
+	}
+	if cnt, err := db.Count(`default`); err != nil || cnt != 0 {
+		t.Fatalf("count: got %d %v, want 0", cnt, err)
+	}
+}
+
+func TestLeaseOverwrite(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		lease Lease
+		data  []byte
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.Store(`default`, `m01`, []byte(`old`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if lease, err = db.Reserve(`default`, 1, time.Minute); err != nil || keysOf(lease.Records) != `m01 ` {
+		t.Fatalf("reserve: got %q %v, want m01", keysOf(lease.Records), err)
+	}
+
+	// A producer stores a new value while the old one is being delivered
+	if err = db.Store(`default`, `m01`, []byte(`new`)); err != nil {
+		t.Fatalf("store again: %s", err)
+	}
+
+	if err = db.Ack(lease.ID, `m01`); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("ack overwritten: got %v, want %v", err, ErrLeaseNotFound)
+	}
+	if data, err = db.SliceDown(`default`); err != nil || string(data) != `new` {
+		t.Fatalf("slice down: got %q %v, want new", data, err)
+	}
+}
+
+func TestLeaseRename(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		lease Lease
+		chunk []ChunkData
+		now   = time.Now()
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	db.now = func() time.Time { return now }
+
+	if err = db.Store(Path(`tenantA`, `outbound`), `m01`, []byte(`1`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if lease, err = db.Reserve(Path(`tenantA`, `outbound`), 1, time.Minute); err != nil || keysOf(lease.Records) != `m01 ` {
+		t.Fatalf("reserve: got %q %v, want m01", keysOf(lease.Records), err)
+	}
+
+	// Buckets with live leases, or with buckets under them that have some, keep their names
+	for _, bucket := range []string{Path(`tenantA`, `outbound`), `tenantA`} {
+		if err = db.RenameBucket(bucket, `archive`); !errors.Is(err, ErrBucketLeased) {
+			t.Fatalf("rename %q: got %v, want %v", bucket, err, ErrBucketLeased)
+		}
+	}
+	if err = db.Ack(lease.ID); err != nil {
+		t.Fatalf("ack after refused rename: %s", err)
+	}
+
+	// Once the lease expires, the bucket can be renamed and its records are visible under the new name
+	if err = db.Store(Path(`tenantA`, `outbound`), `m02`, []byte(`2`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if lease, err = db.Reserve(Path(`tenantA`, `outbound`), 1, time.Minute); err != nil || keysOf(lease.Records) != `m02 ` {
+		t.Fatalf("reserve again: got %q %v, want m02", keysOf(lease.Records), err)
+	}
+	db.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+	if err = db.RenameBucket(`tenantA`, `archive`); err != nil {
+		t.Fatalf("rename expired: %s", err)
+	}
+	if err = db.Ack(lease.ID); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("ack expired lease after rename: got %v, want %v", err, ErrLeaseNotFound)
+	}
+	if chunk, err = db.FetchChunkDown(Path(`archive`, `outbound`), 0, 0); err != nil || keysOf(chunk) != `m02 ` {
+		t.Fatalf("fetch chunk renamed: got %q %v, want m02", keysOf(chunk), err)
+	}
+}
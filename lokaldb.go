@@ -3,8 +3,13 @@
 package lokaldb
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
@@ -15,19 +20,67 @@ var (
 	ErrLocalDatabaseNotYetOpened = errors.New(`local database not yet opened`)
 	ErrCorruptedInternalBucket   = errors.New(`empty or corrupted internal bucket`)
 	ErrBucketDoesNotExist        = errors.New(`bucket does not exist`)
+	ErrBucketExists              = errors.New(`bucket already exists`)
+	ErrInvalidPath               = errors.New(`invalid bucket path`)
 	ErrNoKeysSet                 = errors.New(`no keys set`)
+	ErrTxNotWritable             = errors.New(`transaction not writable`)
+	ErrInvalidCursor             = errors.New(`invalid cursor`)
+	ErrInvalidDirection          = errors.New(`invalid direction`)
+	ErrInvalidLimit              = errors.New(`limit must be greater than zero`)
+	ErrDuplicateID               = errors.New(`generated id already exists`)
+	ErrConflict                  = errors.New(`conflicting write`)
+	ErrInvalidPolicy             = errors.New(`invalid policy`)
+	ErrInvalidIndex              = errors.New(`invalid index`)
+	ErrIndexNotFound             = errors.New(`index not found`)
+	ErrKeyNotFound               = errors.New(`key not found`)
+	ErrLeaseNotFound             = errors.New(`lease not found`)
+	ErrBucketLeased              = errors.New(`bucket has reserved records`)
+	ErrInvalidTimeout            = errors.New(`timeout must be greater than zero`)
 )
 
 // LokalDB is a wrapper around bbolt key-value database to manage messaging data in a local database
 type LokalDB struct {
 	ldb      *bolt.DB
-	FileName string
+	FileName string      // Path of the database file
+	FileMode os.FileMode // Permission of the database file when it is created
+	DirMode  os.FileMode // Permission of the missing parent directories when they are created
+	Options  bolt.Options
+
+	MaxBatchSize  int           // Maximum number of calls group-committed by Batch. Zero keeps the bbolt default
+	MaxBatchDelay time.Duration // Maximum time Batch waits before committing a group. Zero keeps the bbolt default
+
+	IDGenerator IDGenerator // Generator of the keys of records added with Enqueue
+
+	SweepInterval  time.Duration  // Interval of the background removal of expired records. Zero disables it
+	SweepBatchSize int            // Maximum number of expired records removed in each transaction of the sweeper
+	OnExpired      ExpiredHandler // Function that receives the records removed by the sweeper, if set
+
+	mu      sync.RWMutex
+	indexes map[string][]index // Secondary indexes defined on each bucket
+	now     func() time.Time   // Clock of the leases, due times and expiry times. It is time.Now unless replaced by tests
+
+	stop     chan struct{}  // Closed to stop the background sweeper
+	sweeping sync.WaitGroup // Running background sweeper
 }
 
+// Option sets an optional setting of the local database before it is opened
+type Option func(*LokalDB)
+
+// FreelistType is the backend freelist type of the underlying bbolt database
+type FreelistType = bolt.FreelistType
+
+// Freelist types
+const (
+	FreelistArrayType = bolt.FreelistArrayType
+	FreelistMapType   = bolt.FreelistMapType
+)
+
 // ChunkData represents the key-value chunks of data to be used as a result for slices of key-value data
 type ChunkData struct {
 	Key   string
 	Value []byte
+	Seq   uint64 // Position of the record in its bucket. It increases with every new key and is never reused
+	Envelope
 }
 
 const (
@@ -40,978 +93,582 @@ var (
 	recLastIdxKey  []byte = []byte(`f0i5ZSQ15ARMLPZJn6zl`)
 )
 
-// Open opens a local database file. It creates the file if it does not exist.
-func Open(file string) (*LokalDB, error) {
-	ld, err := bolt.Open(
-		file,
-		0600,
-		&bolt.Options{Timeout: 1 * time.Second},
-	)
-	return &LokalDB{
-		ldb:      ld,
-		FileName: file,
-	}, err
-}
-
-// Store inserts data in the local database. It will update records containing the same key with the current value.
-func (db *LokalDB) Store(bucket string, key string, data []byte) error {
-
-	if db.ldb == nil {
-		return ErrLocalDatabaseNotYetOpened
-	}
-
-	var (
-		err    error
-		tx     *bolt.Tx
-		b, inb *bolt.Bucket
-		lstidxb, fstidxb,
-		ctb, keyb []byte
-		lstidx, count int
-	)
-
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	keyb = []byte(key)
-	// Get specified buckets
-	// Also get internal buckets for the specified bucket
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return err
-	}
+// Open opens a local database file. It creates the file and its missing parent directories if they do not exist.
+// The database is opened with a file mode of 0600 and a file lock timeout of 1 second unless overridden by options.
+func Open(file string, opts ...Option) (*LokalDB, error) {
 
-	// Get internal bucket
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return err
+	db := &LokalDB{
+		FileName: file,
+		FileMode: 0600,
+		DirMode:  0700,
+		Options: bolt.Options{
+			Timeout: 1 * time.Second,
+		},
+		IDGenerator: SequenceID,
 	}
 
-	// Get last index used. Update if there is none
-	if lstidxb = inb.Get(recLastIdxKey); lstidxb == nil {
-		lstidxb = []byte(`0`)
-		if err = inb.Put(recLastIdxKey, lstidxb); err != nil {
-			return err
-		}
+	for _, opt := range opts {
+		opt(db)
 	}
 
-	// Get first index used. Update if there is none
-	if fstidxb = inb.Get(recFirstIdxKey); fstidxb == nil {
-		fstidxb = []byte(`1`)
-		if err = inb.Put(recFirstIdxKey, fstidxb); err != nil {
-			return err
+	if !db.Options.ReadOnly {
+		if dir := filepath.Dir(file); dir != `` {
+			if err := os.MkdirAll(dir, db.DirMode); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	// Get bucket record count
-	if ctb = inb.Get(recCntKey); ctb == nil {
-		ctb = []byte(`0`)
-	}
-	count, _ = strconv.Atoi(string(ctb))
-
-	// Check the if key exists in the main bucket
-	// This will be used for index update
-	kx := b.Get(keyb) != nil
-
-	// Store the value
-	if err = b.Put(keyb, data); err != nil {
-		return err
+	ld, err := bolt.Open(file, db.FileMode, &db.Options)
+	if err != nil {
+		return nil, err
 	}
 
-	// Record last record count
-	count++
-	ctb = []byte(strconv.Itoa(count))
-	if err = inb.Put(recCntKey, ctb); err != nil {
-		return err
+	if db.MaxBatchSize > 0 {
+		ld.MaxBatchSize = db.MaxBatchSize
 	}
-
-	if !kx {
-		// If the last index key does not exist in the internal
-		// bucket, it will be created
-		// 1. Mark the record index with the provided key
-		// 2. Use the provided key as key and set the record index
-		// 3. Update the last index
-		lstidx, _ = strconv.Atoi(string(lstidxb))
-		lstidx++
-		lstidxb = []byte(strconv.Itoa(lstidx))
-
-		if err = inb.Put(lstidxb, keyb); err != nil {
-			return err
-		}
-		if err = inb.Put(keyb, lstidxb); err != nil {
-			return err
-		}
-		if err = inb.Put(recLastIdxKey, lstidxb); err != nil {
-			return err
-		}
+	if db.MaxBatchDelay > 0 {
+		ld.MaxBatchDelay = db.MaxBatchDelay
 	}
+	db.ldb = ld
 
-	if err = tx.Commit(); err != nil {
-		return err
+	if db.SweepInterval > 0 && !db.Options.ReadOnly {
+		db.startSweeper()
 	}
 
-	return nil
+	return db, nil
 }
 
-// StoreOnce inserts data in the local database in one go. It will update records containing the same key with the current value.
-func (db *LokalDB) StoreOnce(bucket string, data []ChunkData) error {
-
-	var (
-		err error
-	)
-
-	for _, kv := range data {
-		if err = db.Store(bucket, kv.Key, kv.Value); err != nil {
-			return err
-		}
+// WithFileMode sets the permission of the database file when it is created. The default is 0600.
+func WithFileMode(mode os.FileMode) Option {
+	return func(db *LokalDB) {
+		db.FileMode = mode
 	}
-
-	return nil
 }
 
-// Fetch gets a single record from the local database with the provided key. If the record does not exist, it will return nil.
-func (db *LokalDB) Fetch(bucket string, key string) (data []byte, err error) {
-
-	if db.ldb == nil {
-		return nil, ErrLocalDatabaseNotYetOpened
-	}
-
-	var (
-		tx *bolt.Tx
-		b  *bolt.Bucket
-	)
-
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return
-	}
-
-	data = b.Get([]byte(key))
-
-	if err = tx.Commit(); err != nil {
-		return nil, err
+// WithDirMode sets the permission of the missing parent directories when they are created. The default is 0700.
+func WithDirMode(mode os.FileMode) Option {
+	return func(db *LokalDB) {
+		db.DirMode = mode
 	}
-
-	return
 }
 
-// Delete a single record in the database that matches the provided key.
-func (db *LokalDB) Delete(bucket string, key string) error {
-
-	if db.ldb == nil {
-		return ErrLocalDatabaseNotYetOpened
-	}
-
-	var (
-		err                    error
-		tx                     *bolt.Tx
-		b, inb                 *bolt.Bucket
-		keyb, botidxb, topidxb []byte
-	)
-
-	// Start a writable transaction.
-	if tx, err = db.ldb.Begin(true); err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	keyb = []byte(key)
-
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return err
-	}
-
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return err
-	}
-
-	// Get internal bucket, first index, Get last index
-	if topidxb = inb.Get(recFirstIdxKey); topidxb == nil {
-		return ErrCorruptedInternalBucket
-	}
-
-	if botidxb = inb.Get(recLastIdxKey); botidxb == nil {
-		return ErrCorruptedInternalBucket
-	}
-
-	//log.Printf("Delete: %s (first), %s (last)\n", string(topidxb), string(botidxb))
-
-	if err = del(b, inb, keyb); err != nil {
-		return err
-	}
-
-	if err = atidx(inb, topidxb, botidxb); err != nil {
-		return err
-	}
-
-	if err = abidx(inb, topidxb, botidxb); err != nil {
-		return err
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
+// WithTimeout sets the amount of time to wait to obtain the file lock. A zero timeout waits indefinitely.
+func WithTimeout(timeout time.Duration) Option {
+	return func(db *LokalDB) {
+		db.Options.Timeout = timeout
 	}
-
-	return nil
 }
 
-// DeleteOnce remove records in the local database in one go from a supplied provided key.
-func (db *LokalDB) DeleteOnce(bucket string, key []string) error {
-
-	if len(key) == 0 {
-		return ErrNoKeysSet
-	}
-
-	if db.ldb == nil {
-		return ErrLocalDatabaseNotYetOpened
-	}
-
-	var (
-		tx                     *bolt.Tx
-		err                    error
-		b, inb                 *bolt.Bucket
-		keyb, botidxb, topidxb []byte
-	)
-
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return err
-	}
-
-	// Get internal bucket
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return err
-	}
-
-	// Get internal bucket, first index, last index
-	if topidxb = inb.Get(recFirstIdxKey); topidxb == nil {
-		return ErrCorruptedInternalBucket
-	}
-
-	if botidxb = inb.Get(recLastIdxKey); botidxb == nil {
-		return ErrCorruptedInternalBucket
-	}
-
-	//log.Printf("DeleteOnce: %s (first), %s (last)\n", string(topidxb), string(botidxb))
-
-	for _, k := range key {
-
-		keyb = []byte(k)
-
-		if err = del(b, inb, keyb); err != nil {
-			return err
-		}
-	}
-
-	if err = atidx(inb, topidxb, botidxb); err != nil {
-		return err
-	}
-
-	if err = abidx(inb, topidxb, botidxb); err != nil {
-		return err
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
+// WithReadOnly opens the database in read-only mode with a shared file lock.
+func WithReadOnly(readOnly bool) Option {
+	return func(db *LokalDB) {
+		db.Options.ReadOnly = readOnly
 	}
-
-	return nil
 }
 
-// FetchChunkUp gets a chunk of data starting from the bottom to top limited by max.
-func (db *LokalDB) FetchChunkUp(bucket string, max int, offset int) ([]ChunkData, error) {
-
-	if db.ldb == nil {
-		return []ChunkData{}, ErrLocalDatabaseNotYetOpened
-	}
-
-	var (
-		err           error
-		tx            *bolt.Tx
-		b, inb        *bolt.Bucket
-		keyb, lstidxb []byte
-		lstidx, c     int
-	)
-
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return []ChunkData{}, err
-	}
-
-	// Get internal bucket
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return []ChunkData{}, err
-	}
-
-	// Get last index
-	if lstidxb = inb.Get(recLastIdxKey); lstidxb == nil {
-		return []ChunkData{}, ErrCorruptedInternalBucket
-	}
-	lstidx, _ = strconv.Atoi(string(lstidxb))
-
-	if offset != 0 && offset <= lstidx {
-		lstidx -= offset
-	}
-
-	// Get first index
-	// var fstidxb []byte
-	// if fstidxb = inb.Get(recFirstIdxKey); fstidxb == nil {
-	// 	return ErrCorruptedInternalBucket
-	// }
-
-	// log.Printf("FetchChunkUp: %s (first), %s (last)\n", string(fstidxb), string(lstidxb))
-
-	chunk := make([]ChunkData, 0, lstidx)
-
-	// Loop from first or until count is over the maximum
-	for i := lstidx; i >= 0 && (c < max || max == 0); i-- {
-
-		// get record with the corresponding key
-		// and retrieve using last index key
-		lstidxb = []byte(strconv.Itoa(i))
-
-		if keyb = inb.Get(lstidxb); keyb != nil {
-			chunk = append(chunk, ChunkData{
-				Key:   string(keyb),
-				Value: b.Get(keyb),
-			})
-			c++
-		}
+// WithNoSync skips fsync after each commit. This is faster but the last transactions could be lost on a system crash.
+func WithNoSync(noSync bool) Option {
+	return func(db *LokalDB) {
+		db.Options.NoSync = noSync
 	}
-
-	if err = tx.Commit(); err != nil {
-		return []ChunkData{}, err
-	}
-
-	return chunk, nil
 }
 
-// FetchChunkDown gets a chunk of data starting from the top to bottom limited by max.
-func (db *LokalDB) FetchChunkDown(bucket string, max int, offset int) ([]ChunkData, error) {
-
-	if db.ldb == nil {
-		return []ChunkData{}, ErrLocalDatabaseNotYetOpened
-	}
-
-	var (
-		err                error
-		tx                 *bolt.Tx
-		b, inb             *bolt.Bucket
-		keyb, tmp, curidxb []byte
-		lstidx, c, fstidx  int
-	)
-
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return []ChunkData{}, err
-	}
-
-	// Get internal bucket
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return []ChunkData{}, err
-	}
-
-	if tmp = inb.Get(recFirstIdxKey); tmp == nil {
-		return []ChunkData{}, ErrCorruptedInternalBucket
-	}
-	fstidx, _ = strconv.Atoi(string(tmp))
-
-	if offset != 0 && offset > fstidx {
-		fstidx += offset
-	}
-
-	// Get last index to get where the loop ends
-	if tmp = inb.Get(recLastIdxKey); tmp == nil {
-		return []ChunkData{}, ErrCorruptedInternalBucket
+// WithNoGrowSync skips fsync when the database file grows.
+func WithNoGrowSync(noGrowSync bool) Option {
+	return func(db *LokalDB) {
+		db.Options.NoGrowSync = noGrowSync
 	}
-	lstidx, _ = strconv.Atoi(string(tmp))
-
-	//log.Printf("FetchChunkDown: %d (first), %d (last)\n", fstidx, lstidx)
-
-	chunk := make([]ChunkData, 0, max)
-
-	// Loop from first or until count is over the maximum
-	for i := fstidx; i <= lstidx && (c < max || max == 0); i++ {
-
-		// get record with the corresponding key
-		// and retrieve using first index key
-		curidxb = []byte(strconv.Itoa(i))
-
-		if keyb = inb.Get(curidxb); keyb != nil {
-			chunk = append(chunk, ChunkData{
-				Key:   string(keyb),
-				Value: b.Get(keyb),
-			})
-			c++
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
-		return []ChunkData{}, err
-	}
-
-	return chunk, nil
 }
 
-// FetchDelete gets the record with the provided key and deletes it.
-func (db *LokalDB) FetchDelete(bucket string, key string) ([]byte, error) {
-
-	if db.ldb == nil {
-		return nil, ErrLocalDatabaseNotYetOpened
-	}
-
-	var (
-		err                          error
-		tx                           *bolt.Tx
-		b, inb                       *bolt.Bucket
-		keyb, data, botidxb, topidxb []byte
-	)
-
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	keyb = []byte(key)
-
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return nil, err
+// WithNoFreelistSync skips writing the freelist to disk. Writes are faster but recovery requires a full database scan.
+func WithNoFreelistSync(noFreelistSync bool) Option {
+	return func(db *LokalDB) {
+		db.Options.NoFreelistSync = noFreelistSync
 	}
+}
 
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return nil, err
+// WithPreLoadFreelist loads the free pages when the database is opened.
+func WithPreLoadFreelist(preLoad bool) Option {
+	return func(db *LokalDB) {
+		db.Options.PreLoadFreelist = preLoad
 	}
+}
 
-	// Get internal bucket, first index, Get last index
-	if topidxb = inb.Get(recFirstIdxKey); topidxb == nil {
-		return nil, ErrCorruptedInternalBucket
+// WithFreelistType sets the backend freelist type. The default is FreelistArrayType.
+func WithFreelistType(freelistType FreelistType) Option {
+	return func(db *LokalDB) {
+		db.Options.FreelistType = freelistType
 	}
+}
 
-	if botidxb = inb.Get(recLastIdxKey); botidxb == nil {
-		return nil, ErrCorruptedInternalBucket
+// WithInitialMmapSize sets the initial memory map size of the database in bytes.
+// Read transactions will not block write transactions if the size is large enough to hold the database.
+func WithInitialMmapSize(size int) Option {
+	return func(db *LokalDB) {
+		db.Options.InitialMmapSize = size
 	}
+}
 
-	data = b.Get(keyb)
-
-	if err = del(b, inb, keyb); err != nil {
-		return nil, err
+// WithPageSize overrides the default operating system page size for a new database.
+func WithPageSize(size int) Option {
+	return func(db *LokalDB) {
+		db.Options.PageSize = size
 	}
+}
 
-	if err = atidx(inb, topidxb, botidxb); err != nil {
-		return nil, err
+// WithMmapFlags sets the flags used when memory mapping the database file.
+func WithMmapFlags(flags int) Option {
+	return func(db *LokalDB) {
+		db.Options.MmapFlags = flags
 	}
+}
 
-	if err = abidx(inb, topidxb, botidxb); err != nil {
-		return nil, err
+// WithMlock locks the database file in memory to prevent page faults (UNIX only).
+func WithMlock(mlock bool) Option {
+	return func(db *LokalDB) {
+		db.Options.Mlock = mlock
 	}
+}
 
-	if err = tx.Commit(); err != nil {
-		return nil, err
+// WithMaxBatchSize sets the maximum number of calls group-committed by Batch and StoreBatch.
+func WithMaxBatchSize(size int) Option {
+	return func(db *LokalDB) {
+		db.MaxBatchSize = size
 	}
-
-	return data, nil
 }
 
-// SliceUp fetches and deletes a record from bottom to top.
-func (db *LokalDB) SliceUp(bucket string) (data []byte, err error) {
-
-	if db.ldb == nil {
-		return nil, ErrLocalDatabaseNotYetOpened
+// WithMaxBatchDelay sets the maximum time Batch and StoreBatch wait for other calls before committing.
+func WithMaxBatchDelay(delay time.Duration) Option {
+	return func(db *LokalDB) {
+		db.MaxBatchDelay = delay
 	}
+}
 
-	var (
-		tx                     *bolt.Tx
-		b, inb                 *bolt.Bucket
-		keyb, botidxb, topidxb []byte
-	)
+// Store inserts data in the local database. It will update records containing the same key with the current value.
+// The position of an updated record follows the overwrite policy of the bucket.
+func (db *LokalDB) Store(bucket string, key string, data []byte) error {
+	return db.StoreCtx(context.Background(), bucket, key, data)
+}
 
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
+// StoreCtx is Store with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreCtx(ctx context.Context, bucket string, key string, data []byte) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.Store(bucket, key, data)
+	})
+}
 
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return
-	}
+// StoreOnce inserts data in the local database in one go. It will update records containing the same key with the current value.
+// All records are written in a single transaction. If one of them fails, none of them are stored.
+func (db *LokalDB) StoreOnce(bucket string, data []ChunkData) error {
+	return db.StoreOnceCtx(context.Background(), bucket, data)
+}
 
-	// Get internal bucket
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return
-	}
+// StoreOnceCtx is StoreOnce with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreOnceCtx(ctx context.Context, bucket string, data []ChunkData) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.StoreOnce(bucket, data)
+	})
+}
 
-	// Get internal bucket, first index, Get last index
-	if topidxb = inb.Get(recFirstIdxKey); topidxb == nil {
-		err = ErrCorruptedInternalBucket
-		return
-	}
+// StoreBatch inserts data in the local database like Store. Concurrent calls from many goroutines
+// are group-committed into a single transaction to save disk syncs.
+//
+// The call returns only after the group is committed. If another call in the group fails, the
+// group is retried and this call could be run in a transaction of its own.
+func (db *LokalDB) StoreBatch(bucket string, key string, data []byte) error {
+	return db.StoreBatchCtx(context.Background(), bucket, key, data)
+}
 
-	if botidxb = inb.Get(recLastIdxKey); botidxb == nil {
-		err = ErrCorruptedInternalBucket
-		return
-	}
+// StoreBatchCtx is StoreBatch with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreBatchCtx(ctx context.Context, bucket string, key string, data []byte) error {
+	return db.BatchCtx(ctx, func(tx *Tx) error {
+		return tx.Store(bucket, key, data)
+	})
+}
 
-	// get record with the corresponding key
-	// and retrieve using last index key
-	if keyb = inb.Get(botidxb); err != nil {
-		return
-	}
+// Fetch gets a single record from the local database with the provided key. If the record does not exist, it will return nil.
+func (db *LokalDB) Fetch(bucket string, key string) (data []byte, err error) {
+	return db.FetchCtx(context.Background(), bucket, key)
+}
 
-	if keyb == nil {
-		err = ErrCorruptedInternalBucket
+// FetchCtx is Fetch with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchCtx(ctx context.Context, bucket string, key string) (data []byte, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		data, err = tx.Fetch(bucket, key)
 		return
-	}
-
-	data = b.Get(keyb)
-
-	// lstidx, _ := strconv.Atoi(string(botidxb))
-	// fstidx, _ := strconv.Atoi(string(topidxb))
-	//log.Printf("SliceUp: %d (first), %d (last)\n", fstidx, lstidx)
-
-	if err = del(b, inb, keyb); err != nil {
+	})
+	if err != nil {
 		return nil, err
 	}
-
-	if err = atidx(inb, topidxb, botidxb); err != nil {
-		return
-	}
-
-	if err = abidx(inb, topidxb, botidxb); err != nil {
-		return
-	}
-
-	if err = tx.Commit(); err != nil {
-		data = nil
-		return
-	}
-
 	return
 }
 
-// SliceDown fetches and deletes a record from top to bottom.
-func (db *LokalDB) SliceDown(bucket string) (data []byte, err error) {
-
-	if db.ldb == nil {
-		return nil, ErrLocalDatabaseNotYetOpened
-	}
+// Delete a single record in the database that matches the provided key.
+func (db *LokalDB) Delete(bucket string, key string) error {
+	return db.DeleteCtx(context.Background(), bucket, key)
+}
 
-	var (
-		tx                     *bolt.Tx
-		b, inb                 *bolt.Bucket
-		keyb, botidxb, topidxb []byte
-	)
+// DeleteCtx is Delete with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) DeleteCtx(ctx context.Context, bucket string, key string) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.Delete(bucket, key)
+	})
+}
 
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return
-	}
-	defer tx.Rollback()
+// DeleteOnce remove records in the local database in one go from a supplied provided key.
+func (db *LokalDB) DeleteOnce(bucket string, key []string) error {
+	return db.DeleteOnceCtx(context.Background(), bucket, key)
+}
 
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return
-	}
+// DeleteOnceCtx is DeleteOnce with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) DeleteOnceCtx(ctx context.Context, bucket string, key []string) error {
 
-	// Get internal bucket
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return
+	if len(key) == 0 {
+		return ErrNoKeysSet
 	}
 
-	// Get internal bucket, first index, Get last index
-	if topidxb = inb.Get(recFirstIdxKey); topidxb == nil {
-		err = ErrCorruptedInternalBucket
-		return
-	}
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.DeleteOnce(bucket, key)
+	})
+}
 
-	if botidxb = inb.Get(recLastIdxKey); botidxb == nil {
-		err = ErrCorruptedInternalBucket
-		return
-	}
+// FetchChunkUp gets a chunk of data starting from the bottom to top limited by max.
+func (db *LokalDB) FetchChunkUp(bucket string, max int, offset int) (chunk []ChunkData, err error) {
+	return db.FetchChunkUpCtx(context.Background(), bucket, max, offset)
+}
 
-	// get record with the corresponding key
-	// and retrieve using first index key
-	if keyb = inb.Get(topidxb); err != nil {
+// FetchChunkUpCtx is FetchChunkUp with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchChunkUpCtx(ctx context.Context, bucket string, max int, offset int) (chunk []ChunkData, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		chunk, err = tx.FetchChunkUp(bucket, max, offset)
 		return
+	})
+	if err != nil {
+		return []ChunkData{}, err
 	}
+	return
+}
+
+// FetchChunkDown gets a chunk of data starting from the top to bottom limited by max.
+func (db *LokalDB) FetchChunkDown(bucket string, max int, offset int) (chunk []ChunkData, err error) {
+	return db.FetchChunkDownCtx(context.Background(), bucket, max, offset)
+}
 
-	if keyb == nil {
-		err = ErrCorruptedInternalBucket
+// FetchChunkDownCtx is FetchChunkDown with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchChunkDownCtx(ctx context.Context, bucket string, max int, offset int) (chunk []ChunkData, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		chunk, err = tx.FetchChunkDown(bucket, max, offset)
 		return
+	})
+	if err != nil {
+		return []ChunkData{}, err
 	}
+	return
+}
 
-	data = b.Get(keyb)
+// FetchDelete gets the record with the provided key and deletes it.
+func (db *LokalDB) FetchDelete(bucket string, key string) (data []byte, err error) {
+	return db.FetchDeleteCtx(context.Background(), bucket, key)
+}
 
-	if err = del(b, inb, keyb); err != nil {
+// FetchDeleteCtx is FetchDelete with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchDeleteCtx(ctx context.Context, bucket string, key string) (data []byte, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		data, err = tx.FetchDelete(bucket, key)
 		return
+	})
+	if err != nil {
+		return nil, err
 	}
+	return
+}
 
-	if err = atidx(inb, topidxb, botidxb); err != nil {
-		return
-	}
+// SliceUp fetches and deletes a record from bottom to top.
+func (db *LokalDB) SliceUp(bucket string) (data []byte, err error) {
+	return db.SliceUpCtx(context.Background(), bucket)
+}
 
-	if err = abidx(inb, topidxb, botidxb); err != nil {
+// SliceUpCtx is SliceUp with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) SliceUpCtx(ctx context.Context, bucket string) (data []byte, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		data, err = tx.SliceUp(bucket)
 		return
+	})
+	if err != nil {
+		return nil, err
 	}
+	return
+}
+
+// SliceDown fetches and deletes a record from top to bottom.
+func (db *LokalDB) SliceDown(bucket string) (data []byte, err error) {
+	return db.SliceDownCtx(context.Background(), bucket)
+}
 
-	if err = tx.Commit(); err != nil {
-		data = nil
+// SliceDownCtx is SliceDown with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) SliceDownCtx(ctx context.Context, bucket string) (data []byte, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		data, err = tx.SliceDown(bucket)
 		return
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return
 }
 
 // CutChunkUp gets a chunk of data starting from bottom to top in descending order and removes them.
-func (db *LokalDB) CutChunkUp(bucket string, max int) ([]ChunkData, error) {
+func (db *LokalDB) CutChunkUp(bucket string, max int) (chunk []ChunkData, err error) {
+	return db.CutChunkUpCtx(context.Background(), bucket, max)
+}
 
-	if db.ldb == nil {
-		return []ChunkData{}, ErrLocalDatabaseNotYetOpened
+// CutChunkUpCtx is CutChunkUp with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) CutChunkUpCtx(ctx context.Context, bucket string, max int) (chunk []ChunkData, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		chunk, err = tx.CutChunkUp(bucket, max)
+		return
+	})
+	if err != nil {
+		return []ChunkData{}, err
 	}
+	return
+}
 
-	var (
-		err                             error
-		tx                              *bolt.Tx
-		b, inb                          *bolt.Bucket
-		keyb, botidxb, topidxb, curidxb []byte
-		lstidx                          int
-		c                               int
-		chunk                           []ChunkData
-	)
+// CutChunkDown gets a chunk of data starting from top to bottom in ascending order and removes them.
+func (db *LokalDB) CutChunkDown(bucket string, max int) (chunk []ChunkData, err error) {
+	return db.CutChunkDownCtx(context.Background(), bucket, max)
+}
 
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
+// CutChunkDownCtx is CutChunkDown with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) CutChunkDownCtx(ctx context.Context, bucket string, max int) (chunk []ChunkData, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		chunk, err = tx.CutChunkDown(bucket, max)
+		return
+	})
 	if err != nil {
 		return []ChunkData{}, err
 	}
-	defer tx.Rollback()
+	return
+}
 
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return []ChunkData{}, err
-	}
+// Count records in the bucket
+func (db *LokalDB) Count(bucket string) (count int, err error) {
+	return db.CountCtx(context.Background(), bucket)
+}
 
-	// Get internal bucket and get last index
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return []ChunkData{}, err
+// CountCtx is Count with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) CountCtx(ctx context.Context, bucket string) (count int, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		count, err = tx.Count(bucket)
+		return
+	})
+	if err != nil {
+		return 0, err
 	}
+	return
+}
 
-	// Get internal bucket, last index, first index
-	if botidxb = inb.Get(recLastIdxKey); botidxb == nil {
-		return []ChunkData{}, ErrCorruptedInternalBucket
-	}
+// Close the local database
+func (db *LokalDB) Close() error {
 
-	lstidx, _ = strconv.Atoi(string(botidxb))
+	db.stopSweeper()
 
-	if topidxb = inb.Get(recFirstIdxKey); topidxb == nil {
-		return []ChunkData{}, ErrCorruptedInternalBucket
+	if db.ldb != nil {
+		return db.ldb.Close()
 	}
 
-	// fstidx is not used anywhere except for this log
-	// fstidx, _ := strconv.Atoi(string(topidxb))
-	// log.Printf("CutChunkUp: %d (first), %d (last)\n", fstidx, lstidx)
-
-	chunk = make([]ChunkData, 0, max)
-
-	// Loop from first or until count is over the maximum
-	for i := lstidx; i >= 0 && (c < max || max == 0); i-- {
+	return nil
+}
 
-		// get record with the corresponding key
-		// and retrieve using last index key
-		curidxb = []byte(strconv.Itoa(i))
+// Store record and index it with the secondary indexes of its bucket
+func put(b, inb *bolt.Bucket, key, data []byte, env *Envelope, policy OverwritePolicy, ix []index, now time.Time) error {
 
-		if keyb = inb.Get(curidxb); keyb != nil {
-			chunk = append(chunk, ChunkData{
-				Key:   string(keyb),
-				Value: b.Get(keyb),
-			})
-			c++
-		}
+	if err := place(b, inb, key, data, env, policy, now); err != nil {
+		return err
 	}
 
-	// if no records fetched, exit
-	if len(chunk) == 0 {
-		return []ChunkData{}, nil
-	}
+	return reindex(b, inb, ix, key)
+}
 
-	// Get the record index of the current key
-	// Delete the record index by using current key
-	// Delete the internal bucket value by using the record index
-	// Delete the record by chunk
-	for _, c := range chunk {
-		keyb = []byte(c.Key)
+// Store the value of a record at the time and place it in the index. A nil envelope keeps the envelope
+// of an existing record. The overwrite policy decides what happens to its position.
+func place(b, inb *bolt.Bucket, key, data []byte, env *Envelope, policy OverwritePolicy, now time.Time) error {
 
-		if err = del(b, inb, keyb); err != nil {
-			return []ChunkData{}, ErrCorruptedInternalBucket
-		}
-	}
+	var (
+		err           error
+		lstidxb       []byte
+		fstidx        int
+		lstidx, count int
+		moved         bool
+	)
 
-	if err = atidx(inb, topidxb, botidxb); err != nil {
-		return []ChunkData{}, err
+	// Records share their keys with the buckets under the bucket and their internal buckets
+	if internal(key) {
+		return ErrInvalidPath
 	}
-
-	if err = abidx(inb, topidxb, botidxb); err != nil {
-		return []ChunkData{}, err
+	if b.Bucket(key) != nil {
+		return ErrBucketExists
 	}
 
-	if err = tx.Commit(); err != nil {
-		return []ChunkData{}, err
+	// Get last and first index used.
+	// A first index of zero means the bucket is empty.
+	lstidx = getint(inb, recLastIdxKey)
+	if fstidx = getint(inb, recFirstIdxKey); inb.Get(recFirstIdxKey) == nil {
+		fstidx = 1
+		if err = putint(inb, recFirstIdxKey, fstidx); err != nil {
+			return err
+		}
 	}
 
-	return chunk, nil
-
-}
-
-// CutChunkDown gets a chunk of data starting from top to bottom in ascending order and removes them.
-func (db *LokalDB) CutChunkDown(bucket string, max int) ([]ChunkData, error) {
+	// Get bucket record count
+	count = getint(inb, recCntKey)
 
-	if db.ldb == nil {
-		return []ChunkData{}, ErrLocalDatabaseNotYetOpened
+	// Check the if key exists in the main bucket
+	// This will be used for index update
+	kx := b.Get(key) != nil
+	if kx {
+		switch overwritePolicy(inb, policy) {
+		case RejectOverwrite:
+			return ErrConflict
+		case MoveToTail:
+			moved = true
+		}
 	}
 
-	var (
-		err                             error
-		tx                              *bolt.Tx
-		b, inb                          *bolt.Bucket
-		keyb, botidxb, topidxb, curidxb []byte
-		lstidx                          int
-		fstidx                          int
-		c                               int
-		chunk                           []ChunkData
-	)
-
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return nil, err
+	// Store the value
+	if err = b.Put(key, data); err != nil {
+		return err
 	}
-	defer tx.Rollback()
-
-	if b, err = tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
-		return nil, err
+	if err = bumpRevision(b, inb, key, kx); err != nil {
+		return err
 	}
-
-	// Get internal bucket and get last index
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return nil, err
+	if err = stampEnvelope(inb, key, env, kx, now); err != nil {
+		return err
 	}
-
-	if topidxb = inb.Get(recFirstIdxKey); topidxb == nil {
-		return []ChunkData{}, ErrCorruptedInternalBucket
+	if err = dropChunks(inb, key); err != nil {
+		return err
 	}
-	fstidx, _ = strconv.Atoi(string(topidxb))
-
-	if botidxb = inb.Get(recLastIdxKey); botidxb == nil {
-		return []ChunkData{}, ErrCorruptedInternalBucket
+	if err = unschedule(inb, recDueBucket, key); err != nil {
+		return err
+	}
+	if err = expireDefault(inb, key, now); err != nil {
+		return err
 	}
-	lstidx, _ = strconv.Atoi(string(botidxb))
-
-	// log.Printf("CutChunkDown: %d (first), %d (last)\n", fstidx, lstidx)
-
-	chunk = make([]ChunkData, 0, max)
-
-	// Loop from first or until count is over the maximum
-	for i := fstidx; i <= lstidx && (c < max || max == 0); i++ {
 
-		// get record with the corresponding key
-		// and retrieve using first index key
-		curidxb = []byte(strconv.Itoa(i))
+	// A new value has not been delivered, so the lease of the old one does not hold it
+	if err = release(inb, key); err != nil {
+		return err
+	}
 
-		if keyb = inb.Get(curidxb); err == nil {
-			chunk = append(chunk, ChunkData{
-				Key:   string(keyb),
-				Value: b.Get(keyb),
-			})
-			c++
+	// An overwritten record is not counted again
+	if !kx {
+		count++
+		if err = putint(inb, recCntKey, count); err != nil {
+			return err
 		}
 	}
 
-	// if no records fetched, exit
-	if len(chunk) == 0 {
-		return nil, nil
+	if kx && !moved {
+		return nil
 	}
 
-	// Get the record index of the current key
-	// Delete the record index by using current key
-	// Delete the internal bucket value by using the record index
-	// Delete the record by chunk
-	for _, c := range chunk {
-
-		keyb = []byte(c.Key)
-
-		if err = del(b, inb, keyb); err != nil {
-			return []ChunkData{}, ErrCorruptedInternalBucket
+	// Unlink the record from its old position
+	if moved {
+		if err = inb.Delete(bytes.Clone(inb.Get(key))); err != nil {
+			return err
 		}
 	}
 
-	if err = atidx(inb, topidxb, botidxb); err != nil {
-		return []ChunkData{}, err
+	// If the last index key does not exist in the internal
+	// bucket, it will be created
+	// 1. Mark the record index with the provided key
+	// 2. Use the provided key as key and set the record index
+	// 3. Update the last index
+	lstidx++
+	lstidxb = []byte(strconv.Itoa(lstidx))
+
+	if err = inb.Put(lstidxb, key); err != nil {
+		return err
+	}
+	if err = inb.Put(key, lstidxb); err != nil {
+		return err
+	}
+	if err = inb.Put(recLastIdxKey, lstidxb); err != nil {
+		return err
 	}
 
-	if err = abidx(inb, topidxb, botidxb); err != nil {
-		return []ChunkData{}, err
+	// The first record could have been moved
+	if moved {
+		return atidx(inb, fstidx, lstidx)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return []ChunkData{}, err
+	// Databases written by earlier versions reset the first index to zero
+	// when the bucket was emptied. Point it to the first record again.
+	if fstidx == 0 {
+		fstidx, _ = head(inb)
+		if err = putint(inb, recFirstIdxKey, fstidx); err != nil {
+			return err
+		}
 	}
 
-	return chunk, nil
+	return nil
 }
 
-// Count records in the bucket
-func (db *LokalDB) Count(bucket string) (int, error) {
-
-	if db.ldb == nil {
-		return 0, ErrLocalDatabaseNotYetOpened
-	}
+// Remove records and adjust the first and last index once
+func remove(b, inb *bolt.Bucket, keys ...[]byte) error {
 
 	var (
-		err   error
-		tx    *bolt.Tx
-		inb   *bolt.Bucket
-		ctb   []byte
-		count int
+		err            error
+		fstidx, lstidx int
 	)
 
-	// Start a writable transaction.
-	tx, err = db.ldb.Begin(true)
-	if err != nil {
-		return 0, err
-	}
-	defer tx.Rollback()
-
-	if inb, err = tx.CreateBucketIfNotExists([]byte(intBucket + `-` + bucket)); err != nil {
-		return 0, err
-	}
-
-	if ctb = inb.Get(recCntKey); ctb == nil {
-		ctb = []byte(`0`)
+	// Get internal bucket, first index, last index
+	if inb.Get(recFirstIdxKey) == nil || inb.Get(recLastIdxKey) == nil {
+		return ErrCorruptedInternalBucket
 	}
+	fstidx = getint(inb, recFirstIdxKey)
+	lstidx = getint(inb, recLastIdxKey)
 
-	count, _ = strconv.Atoi(string(ctb))
-
-	if err = tx.Commit(); err != nil {
-		return 0, err
+	for _, k := range keys {
+		if err = del(b, inb, k); err != nil {
+			return err
+		}
 	}
 
-	return count, nil
-}
-
-// Close the local database
-func (db *LokalDB) Close() error {
-
-	if db.ldb != nil {
-		return db.ldb.Close()
+	if err = atidx(inb, fstidx, lstidx); err != nil {
+		return err
 	}
 
-	return nil
+	return abidx(inb, fstidx, lstidx)
 }
 
 // after deletion, this searches for the next record by iterating to the bottom
-func atidx(inb *bolt.Bucket, topidx, botidx []byte) error {
-
-	var (
-		err     error
-		bidx    int
-		curidxb []byte
-		curidx  int
-		found   bool
-	)
-
-	// Delete the index by using the provided key
-	// Delete the key by using the index
-	bidx, _ = strconv.Atoi((string(botidx)))
-	curidx, _ = strconv.Atoi((string(curidxb)))
+func atidx(inb *bolt.Bucket, tidx, bidx int) error {
 
 	// Look the next index from the top to bottom
-	// If there is no first index, set to zero
-	found = false
-	for i := curidx; i <= bidx; i++ {
+	// If there is no record left, the first index is set past the last index
+	// so that the indexes of new records keep increasing
+	for i := tidx; i <= bidx; i++ {
 		ci := []byte(strconv.Itoa(i))
 		if inb.Get(ci) != nil {
-			if err = inb.Put(recFirstIdxKey, ci); err == nil {
-				found = true
-			}
-			break
+			return inb.Put(recFirstIdxKey, ci)
 		}
 	}
 
-	if err != nil {
-		return err
-	}
-
-	if !found {
-		if err = inb.Put(recFirstIdxKey, []byte(`0`)); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return putint(inb, recFirstIdxKey, bidx+1)
 }
 
 // Adjust bottom index
 // after deletion, this searches for the previous record by iterating to the top
-func abidx(inb *bolt.Bucket, topidx, botidx []byte) error {
-
-	var (
-		err   error
-		tidx  int
-		bidx  int
-		found bool
-	)
-
-	// Delete the index by using the provided key
-	// Delete the key by using the index
-	tidx, _ = strconv.Atoi((string(topidx)))
-	bidx, _ = strconv.Atoi((string(botidx)))
+func abidx(inb *bolt.Bucket, tidx, bidx int) error {
 
 	// Look for the previous next index by looping from bottom to top
-	// If there is no last index, set to zero
-	found = false
+	// If there is no record left, the last index is kept
 	for i := bidx; i >= tidx; i-- {
 		ci := []byte(strconv.Itoa(i))
 		if inb.Get(ci) != nil {
-			if err = inb.Put(recLastIdxKey, ci); err == nil {
-				found = true
-			}
-			break
-		}
-	}
-
-	if err != nil {
-		return err
-	}
-
-	if !found {
-		if err = inb.Put(recLastIdxKey, []byte(`0`)); err != nil {
-			return err
+			return inb.Put(recLastIdxKey, ci)
 		}
 	}
 
@@ -1021,9 +678,8 @@ func abidx(inb *bolt.Bucket, topidx, botidx []byte) error {
 // Delete record
 func del(b, inb *bolt.Bucket, key []byte) error {
 	var (
-		err          error
-		curidxb, ctb []byte
-		count        int
+		err     error
+		curidxb []byte
 	)
 
 	// Get the index from the internal bucket
@@ -1031,8 +687,7 @@ func del(b, inb *bolt.Bucket, key []byte) error {
 		return nil
 	}
 
-	// Delete the record containing the index
-	if err = inb.Delete(key); err != nil {
+	if err = unindex(inb, key); err != nil {
 		return err
 	}
 
@@ -1041,24 +696,136 @@ func del(b, inb *bolt.Bucket, key []byte) error {
 		return err
 	}
 
-	if err = b.Delete(key); err != nil {
+	// Delete the record containing the index
+	if err = inb.Delete(key); err != nil {
 		return err
 	}
 
-	// Get bucket record count
-	if ctb = inb.Get(recCntKey); ctb == nil {
-		ctb = []byte(`0`)
+	if err = b.Delete(key); err != nil {
+		return err
+	}
+	if err = dropRevision(inb, key); err != nil {
+		return err
+	}
+	if err = dropEnvelope(inb, key); err != nil {
+		return err
+	}
+	if err = dropChunks(inb, key); err != nil {
+		return err
+	}
+	if err = release(inb, key); err != nil {
+		return err
+	}
+	if err = unschedule(inb, recDueBucket, key); err != nil {
+		return err
+	}
+	if err = unschedule(inb, recExpBucket, key); err != nil {
+		return err
 	}
-	count, _ = strconv.Atoi(string(ctb))
 
 	// Deduct from current count
-	count--
-	ctb = []byte(strconv.Itoa(count))
-	if err = inb.Put(recCntKey, ctb); err != nil {
-		return err
+	return putint(inb, recCntKey, getint(inb, recCntKey)-1)
+}
+
+// Get the record with the key at the index together with its envelope
+func record(b, inb *bolt.Bucket, keyb []byte, idx int) ChunkData {
+	return ChunkData{
+		Key:      string(keyb),
+		Value:    value(b, inb, keyb),
+		Seq:      uint64(idx),
+		Envelope: envelope(inb, keyb),
+	}
+}
+
+// Get the first record index and its key. Indexes are walked forward
+// in case the first index is behind the first record.
+func head(inb *bolt.Bucket) (idx int, keyb []byte) {
+	walk(inb, -1, true, func(i int, k []byte) bool {
+		idx, keyb = i, k
+		return false
+	})
+	return
+}
+
+// Walk the records in index order from the top to the bottom (forward) or from the bottom
+// to the top, calling fn with the index and key of each record until it returns false.
+// A negative index starts at the first or last record.
+func walk(inb *bolt.Bucket, idx int, forward bool, fn func(idx int, keyb []byte) bool) {
+
+	var (
+		keyb           []byte
+		fstidx, lstidx int
+	)
+
+	fstidx = getint(inb, recFirstIdxKey)
+	lstidx = getint(inb, recLastIdxKey)
+
+	if forward {
+		if idx < fstidx {
+			idx = fstidx
+		}
+		for ; idx <= lstidx; idx++ {
+			if keyb = inb.Get([]byte(strconv.Itoa(idx))); keyb != nil && !fn(idx, keyb) {
+				return
+			}
+		}
+		return
+	}
+
+	if idx < 0 || idx > lstidx {
+		idx = lstidx
 	}
+	for ; idx >= fstidx && idx > 0; idx-- {
+		if keyb = inb.Get([]byte(strconv.Itoa(idx))); keyb != nil && !fn(idx, keyb) {
+			return
+		}
+	}
+}
 
-	// log.Printf("del: %s (current index)\n", string(curidxb))
+// Walk the records like walk, skipping the records that are hidden from consumers at the time.
+// Due times are only looked up while the due time index has a record that is not due yet.
+func ready(inb *bolt.Bucket, idx int, forward bool, now time.Time, fn func(idx int, keyb []byte) bool) {
+	pending := delaying(inb, now)
+	walk(inb, idx, forward, func(i int, k []byte) bool {
+		if leased(inb, k, now) || expired(inb, k, now) || (pending && delayed(inb, k, now)) {
+			return true
+		}
+		return fn(i, k)
+	})
+}
 
-	return nil
+// Get the index and key of the first or last record visible at the time
+func next(inb *bolt.Bucket, forward bool, now time.Time) (idx int, keyb []byte) {
+	ready(inb, -1, forward, now, func(i int, k []byte) bool {
+		idx, keyb = i, k
+		return false
+	})
+	return
+}
+
+// Walk the records like walk, skipping the records that have expired at the time
+func live(inb *bolt.Bucket, idx int, forward bool, now time.Time, fn func(idx int, keyb []byte) bool) {
+	walk(inb, idx, forward, func(i int, k []byte) bool {
+		if expired(inb, k, now) {
+			return true
+		}
+		return fn(i, k)
+	})
+}
+
+// Check if a record can be consumed at the time. Records reserved by a lease that has not expired,
+// records that are not due yet and expired records are hidden.
+func visible(inb *bolt.Bucket, key []byte, now time.Time) bool {
+	return !leased(inb, key, now) && !delayed(inb, key, now) && !expired(inb, key, now)
+}
+
+// Get an integer value stored in the internal bucket. Missing values are zero.
+func getint(inb *bolt.Bucket, key []byte) int {
+	v, _ := strconv.Atoi(string(inb.Get(key)))
+	return v
+}
+
+// Store an integer value in the internal bucket
+func putint(inb *bolt.Bucket, key []byte, v int) error {
+	return inb.Put(key, []byte(strconv.Itoa(v)))
 }
@@ -1,11 +1,16 @@
 package lokaldb
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -387,6 +392,91 @@ func TestStore(t *testing.T) {
 
 }
 
+func TestOpenOptions(t *testing.T) {
+	var (
+		err error
+		b   []byte
+		db  *LokalDB
+		fi  os.FileInfo
+	)
+
+	file := filepath.Join(t.TempDir(), `spool`, `nats`, `test.db`)
+
+	db, err = Open(file, WithFileMode(0640), WithTimeout(5*time.Second), WithNoSync(true), WithFreelistType(FreelistMapType))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+
+	if fi, err = os.Stat(file); err != nil {
+		t.Fatalf("stat: %s", err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Fatalf("file mode: got %o, want %o", fi.Mode().Perm(), 0640)
+	}
+	if db.Options.Timeout != 5*time.Second || !db.Options.NoSync || db.Options.FreelistType != FreelistMapType {
+		t.Fatalf("options not kept: %+v", db.Options)
+	}
+
+	if err = db.Store(`default`, `name`, []byte(`George`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	db.Close()
+
+	db, err = Open(file, WithReadOnly(true))
+	if err != nil {
+		t.Fatalf("open read-only: %s", err)
+	}
+	defer db.Close()
+
+	if b, err = db.Fetch(`default`, `name`); err != nil || string(b) != `George` {
+		t.Fatalf("fetch read-only: %q, %v", b, err)
+	}
+
+	if err = db.Store(`default`, `name`, []byte(`Ringo`)); !errors.Is(err, bolt.ErrDatabaseReadOnly) {
+		t.Fatalf("store read-only: got %v, want %v", err, bolt.ErrDatabaseReadOnly)
+	}
+
+	if db, err = Open(filepath.Join(t.TempDir(), `missing.db`), WithReadOnly(true)); db != nil || err == nil {
+		t.Fatalf("open missing read-only: got %v, %v", db, err)
+	}
+}
+
+func TestReadMissingBucket(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if _, err = db.Fetch(`missing`, `key`); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("Fetch: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+	if _, err = db.FetchChunkUp(`missing`, 10, 0); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("FetchChunkUp: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+	if _, err = db.FetchChunkDown(`missing`, 10, 0); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("FetchChunkDown: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+	if _, err = db.Count(`missing`); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("Count: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+
+	// Reads must not create the bucket as a side effect
+	if err = db.ldb.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(`missing`)) != nil || tx.Bucket([]byte(intBucket+`-missing`)) != nil {
+			return errors.New(`bucket created by a read`)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func StringWithCharset(length int, charset string) []byte {
 	b := make([]byte, length)
 	for i := range b {
@@ -398,3 +488,39 @@ func StringWithCharset(length int, charset string) []byte {
 func String(length int) []byte {
 	return StringWithCharset(length, charset)
 }
+
+func TestChunkLimit(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.Store(`default`, `m01`, []byte(`1`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+
+	if _, err = db.FetchChunkDown(`default`, -1, 0); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("fetch chunk down negative: got %v, want %v", err, ErrInvalidLimit)
+	}
+	if _, err = db.FetchChunkUp(`default`, -1, 0); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("fetch chunk up negative: got %v, want %v", err, ErrInvalidLimit)
+	}
+	if _, err = db.CutChunkDown(`default`, -1); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("cut chunk down negative: got %v, want %v", err, ErrInvalidLimit)
+	}
+	if _, err = db.CutChunkUp(`default`, -1); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("cut chunk up negative: got %v, want %v", err, ErrInvalidLimit)
+	}
+
+	// Nothing was removed by the rejected cuts
+	if chunk, err = db.FetchChunkDown(`default`, 0, 0); err != nil || keysOf(chunk) != `m01 ` {
+		t.Fatalf("fetch chunk down: got %q %v, want m01", keysOf(chunk), err)
+	}
+}
@@ -0,0 +1,57 @@
+package lokaldb
+
+import (
+	"context"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FetchMany gets the records with the provided keys in one read-only transaction, in the order of the keys.
+// Keys without a record are not an error: they are returned in missing, in the order of the keys.
+func (db *LokalDB) FetchMany(bucket string, keys []string) (chunk []ChunkData, missing []string, err error) {
+	return db.FetchManyCtx(context.Background(), bucket, keys)
+}
+
+// FetchManyCtx is FetchMany with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchManyCtx(ctx context.Context, bucket string, keys []string) (chunk []ChunkData, missing []string, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		chunk, missing, err = tx.FetchMany(bucket, keys)
+		return
+	})
+	if err != nil {
+		return []ChunkData{}, nil, err
+	}
+	return
+}
+
+// FetchMany gets the records with the provided keys in the order of the keys, and the keys without a record
+func (tx *Tx) FetchMany(bucket string, keys []string) ([]ChunkData, []string, error) {
+
+	var (
+		err     error
+		b, inb  *bolt.Bucket
+		chunk   = make([]ChunkData, 0, len(keys))
+		missing []string
+		now     = tx.now()
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil {
+		return []ChunkData{}, nil, err
+	}
+
+	for _, key := range keys {
+		if err = tx.ctx.Err(); err != nil {
+			return []ChunkData{}, nil, err
+		}
+
+		keyb := []byte(key)
+		if inb == nil || b.Get(keyb) == nil || expired(inb, keyb, now) {
+			missing = append(missing, key)
+			continue
+		}
+
+		chunk = append(chunk, record(b, inb, keyb, getint(inb, keyb)))
+	}
+
+	return chunk, missing, nil
+}
@@ -0,0 +1,48 @@
+package lokaldb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetchMany(t *testing.T) {
+	var (
+		err     error
+		db      *LokalDB
+		chunk   []ChunkData
+		missing []string
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 5; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("k%02d", i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	chunk, missing, err = db.FetchMany(`default`, []string{`k04`, `gone`, `k01`, `k05`, `lost`})
+	if err != nil {
+		t.Fatalf("fetch many: %s", err)
+	}
+	if keysOf(chunk) != `k04 k01 k05 ` || string(chunk[1].Value) != `value-1` || chunk[0].Seq != 4 {
+		t.Fatalf("fetch many: got %s", keysOf(chunk))
+	}
+	if strings.Join(missing, ` `) != `gone lost` {
+		t.Fatalf("fetch many: got missing %v", missing)
+	}
+
+	if chunk, missing, err = db.FetchMany(`default`, nil); err != nil || len(chunk) != 0 || missing != nil {
+		t.Fatalf("fetch many without keys: got %v, %v, %v", chunk, missing, err)
+	}
+	if _, _, err = db.FetchMany(`nothing`, []string{`k01`}); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("fetch many missing bucket: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+}
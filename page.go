@@ -0,0 +1,127 @@
+package lokaldb
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Direction is the order in which FetchPage reads the records of a bucket
+type Direction int
+
+// Directions
+const (
+	Down Direction = iota // From top to bottom (FIFO)
+	Up                    // From bottom to top (LIFO)
+)
+
+// Page is a page of records returned by FetchPage
+type Page struct {
+	Records    []ChunkData
+	NextCursor string // Opaque cursor to pass to FetchPage to get the records after this page
+	More       bool   // True if there were more records after this page when it was read
+}
+
+// FetchPage gets a page of up to limit records in the direction, starting after the cursor.
+// An empty cursor starts at the top (Down) or the bottom (Up) of the bucket.
+//
+// The cursor refers to a position in the queue, not to a record number. Records that are removed
+// after a page is read are never skipped or repeated, and records stored later appear on a next page
+// when reading Down. A cursor of a page read in one direction cannot be used in the other direction.
+// A direction other than Down or Up returns ErrInvalidDirection.
+func (db *LokalDB) FetchPage(bucket string, cursor string, limit int, direction Direction) (Page, error) {
+	return db.FetchPageCtx(context.Background(), bucket, cursor, limit, direction)
+}
+
+// FetchPageCtx is FetchPage with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchPageCtx(ctx context.Context, bucket string, cursor string, limit int, direction Direction) (pg Page, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		pg, err = tx.FetchPage(bucket, cursor, limit, direction)
+		return
+	})
+	if err != nil {
+		return Page{}, err
+	}
+	return
+}
+
+// FetchPage gets a page of up to limit records in the direction, starting after the cursor.
+func (tx *Tx) FetchPage(bucket string, cursor string, limit int, direction Direction) (Page, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		idx    int
+		pg     Page
+	)
+
+	if limit <= 0 {
+		return Page{}, ErrInvalidLimit
+	}
+
+	if direction != Down && direction != Up {
+		return Page{}, ErrInvalidDirection
+	}
+
+	if idx, err = decodeCursor(cursor, direction); err != nil {
+		return Page{}, err
+	}
+
+	if b, inb, err = tx.bucket(bucket); err != nil {
+		return Page{}, err
+	}
+
+	// A bucket without an internal bucket has no records yet.
+	if inb == nil {
+		return Page{
+			Records:    []ChunkData{},
+			NextCursor: encodeCursor(idx, direction),
+		}, nil
+	}
+
+	pg.Records, idx, pg.More = page(b, inb, idx, direction == Down, limit, tx.now())
+	pg.NextCursor = encodeCursor(idx, direction)
+
+	return pg, nil
+}
+
+// Encode the index to continue from with the direction
+func encodeCursor(idx int, direction Direction) string {
+
+	d := `d`
+	if direction == Up {
+		d = `u`
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(d + strconv.Itoa(idx)))
+}
+
+// Decode the index to continue from. An empty cursor starts at the first or last record.
+func decodeCursor(cursor string, direction Direction) (int, error) {
+
+	var (
+		err error
+		raw []byte
+		idx int
+	)
+
+	if cursor == `` {
+		return -1, nil
+	}
+
+	if raw, err = base64.RawURLEncoding.DecodeString(cursor); err != nil || len(raw) < 2 {
+		return 0, ErrInvalidCursor
+	}
+
+	if (raw[0] == 'd') != (direction == Down) || (raw[0] != 'd' && raw[0] != 'u') {
+		return 0, ErrInvalidCursor
+	}
+
+	if idx, err = strconv.Atoi(string(raw[1:])); err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,169 @@
+package lokaldb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func keysOf(chunk []ChunkData) string {
+	s := ``
+	for _, kv := range chunk {
+		s += kv.Key + ` `
+	}
+	return s
+}
+
+func TestFetchPage(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		pg  Page
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 25; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("m%02d", i), []byte(`data`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	if pg, err = db.FetchPage(`default`, ``, 10, Down); err != nil {
+		t.Fatalf("page 1: %s", err)
+	}
+	if got := keysOf(pg.Records); got != `m00 m01 m02 m03 m04 m05 m06 m07 m08 m09 ` || !pg.More {
+		t.Fatalf("page 1: got %s (more %v)", got, pg.More)
+	}
+
+	// Records removed and stored by others between pages
+	ks := []string{}
+	for i := 5; i <= 15; i++ {
+		ks = append(ks, fmt.Sprintf("m%02d", i))
+	}
+	if err = db.DeleteOnce(`default`, ks); err != nil {
+		t.Fatalf("delete once: %s", err)
+	}
+	for i := 25; i < 28; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("m%02d", i), []byte(`data`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	if pg, err = db.FetchPage(`default`, pg.NextCursor, 10, Down); err != nil {
+		t.Fatalf("page 2: %s", err)
+	}
+	if got := keysOf(pg.Records); got != `m16 m17 m18 m19 m20 m21 m22 m23 m24 m25 ` || !pg.More {
+		t.Fatalf("page 2: got %s (more %v)", got, pg.More)
+	}
+
+	if pg, err = db.FetchPage(`default`, pg.NextCursor, 10, Down); err != nil {
+		t.Fatalf("page 3: %s", err)
+	}
+	if got := keysOf(pg.Records); got != `m26 m27 ` || pg.More {
+		t.Fatalf("page 3: got %s (more %v)", got, pg.More)
+	}
+
+	// The cursor stays valid after the bucket is emptied and refilled
+	if _, err = db.CutChunkDown(`default`, 0); err != nil {
+		t.Fatalf("cut chunk down: %s", err)
+	}
+	if err = db.Store(`default`, `m28`, []byte(`data`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if pg, err = db.FetchPage(`default`, pg.NextCursor, 10, Down); err != nil {
+		t.Fatalf("page 4: %s", err)
+	}
+	if got := keysOf(pg.Records); got != `m28 ` {
+		t.Fatalf("page 4: got %s", got)
+	}
+
+	if _, err = db.FetchPage(`default`, pg.NextCursor, 10, Up); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("direction mismatch: got %v, want %v", err, ErrInvalidCursor)
+	}
+	if _, err = db.FetchPage(`default`, `not a cursor`, 10, Down); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("invalid cursor: got %v, want %v", err, ErrInvalidCursor)
+	}
+	for _, direction := range []Direction{-1, 7} {
+		if _, err = db.FetchPage(`default`, ``, 10, direction); !errors.Is(err, ErrInvalidDirection) {
+			t.Fatalf("invalid direction %d: got %v, want %v", direction, err, ErrInvalidDirection)
+		}
+	}
+}
+
+func TestFetchPageUp(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		pg  Page
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 7; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("m%02d", i), []byte(`data`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	got := ``
+	for {
+		if pg, err = db.FetchPage(`default`, pg.NextCursor, 3, Up); err != nil {
+			t.Fatalf("page: %s", err)
+		}
+		got += keysOf(pg.Records)
+		if !pg.More {
+			break
+		}
+	}
+	if got != `m06 m05 m04 m03 m02 m01 m00 ` {
+		t.Fatalf("pages up: got %s", got)
+	}
+}
+
+func TestFetchChunkOffset(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("m%02d", i), []byte(`data`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+	if err = db.DeleteOnce(`default`, []string{`m00`, `m01`, `m04`}); err != nil {
+		t.Fatalf("delete once: %s", err)
+	}
+
+	// Offsets count records, not internal indexes
+	if chunk, err = db.FetchChunkDown(`default`, 2, 1); err != nil {
+		t.Fatalf("fetch chunk down: %s", err)
+	}
+	if got := keysOf(chunk); got != `m03 m05 ` {
+		t.Fatalf("fetch chunk down: got %s", got)
+	}
+
+	if chunk, err = db.FetchChunkUp(`default`, 3, 2); err != nil {
+		t.Fatalf("fetch chunk up: %s", err)
+	}
+	if got := keysOf(chunk); got != `m07 m06 m05 ` {
+		t.Fatalf("fetch chunk up: got %s", got)
+	}
+}
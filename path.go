@@ -0,0 +1,313 @@
+package lokaldb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// PathSeparator separates the elements of a bucket path. It is a control character
+// so that existing bucket names, even with dots or slashes, keep their meaning.
+const PathSeparator = "\x1f"
+
+// Path joins the elements into a bucket path that is accepted wherever a bucket name is.
+// Each element is a nested bucket with its own records and index bookkeeping.
+//
+//	db.Store(lokaldb.Path(`tenantA`, `orders`), key, data)
+func Path(elems ...string) string {
+	return strings.Join(elems, PathSeparator)
+}
+
+// SplitPath splits a bucket path into its elements. The empty path is the root of the database.
+func SplitPath(bucket string) []string {
+
+	if bucket == `` {
+		return nil
+	}
+
+	return strings.Split(bucket, PathSeparator)
+}
+
+// ListChildren gets the names of the buckets directly under the bucket path in ascending order.
+// The empty path lists the top level buckets.
+func (db *LokalDB) ListChildren(bucket string) ([]string, error) {
+	return db.ListChildrenCtx(context.Background(), bucket)
+}
+
+// ListChildrenCtx is ListChildren with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) ListChildrenCtx(ctx context.Context, bucket string) (names []string, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		names, err = tx.ListChildren(bucket)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ListTree gets the paths of all buckets under the bucket path, parents before their children.
+// The empty path lists all buckets of the database.
+func (db *LokalDB) ListTree(bucket string) ([]string, error) {
+	return db.ListTreeCtx(context.Background(), bucket)
+}
+
+// ListTreeCtx is ListTree with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) ListTreeCtx(ctx context.Context, bucket string) (paths []string, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		paths, err = tx.ListTree(bucket)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// CountTree counts the records of the bucket and all buckets under it
+func (db *LokalDB) CountTree(bucket string) (int, error) {
+	return db.CountTreeCtx(context.Background(), bucket)
+}
+
+// CountTreeCtx is CountTree with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) CountTreeCtx(ctx context.Context, bucket string) (count int, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		count, err = tx.CountTree(bucket)
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// PurgeTree removes the records of the bucket and all buckets under it. The buckets are kept.
+func (db *LokalDB) PurgeTree(bucket string) error {
+	return db.PurgeTreeCtx(context.Background(), bucket)
+}
+
+// PurgeTreeCtx is PurgeTree with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) PurgeTreeCtx(ctx context.Context, bucket string) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.PurgeTree(bucket)
+	})
+}
+
+// ListChildren gets the names of the buckets directly under the bucket path in ascending order
+func (tx *Tx) ListChildren(bucket string) ([]string, error) {
+
+	var (
+		err error
+		c   container
+	)
+
+	if c, err = tx.container(bucket); err != nil {
+		return nil, err
+	}
+
+	return children(c), nil
+}
+
+// ListTree gets the paths of all buckets under the bucket path, parents before their children
+func (tx *Tx) ListTree(bucket string) ([]string, error) {
+
+	var (
+		err   error
+		paths = make([]string, 0)
+	)
+
+	err = tx.tree(bucket, func(path string, _, _ *bolt.Bucket) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// CountTree counts the records of the bucket and all buckets under it
+func (tx *Tx) CountTree(bucket string) (int, error) {
+
+	var (
+		err   error
+		count int
+	)
+
+	if bucket != `` {
+		if count, err = tx.Count(bucket); err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.tree(bucket, func(_ string, _, inb *bolt.Bucket) error {
+		if inb != nil {
+			count += getint(inb, recCntKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// PurgeTree removes the records of the bucket and all buckets under it
+func (tx *Tx) PurgeTree(bucket string) error {
+
+	if !tx.tx.Writable() {
+		return ErrTxNotWritable
+	}
+
+	if bucket != `` {
+		if err := tx.PurgeBucket(bucket); err != nil {
+			return err
+		}
+	}
+
+	return tx.tree(bucket, func(_ string, b, inb *bolt.Bucket) error {
+		if inb == nil {
+			return nil
+		}
+		return purge(tx.ctx, b, inb)
+	})
+}
+
+// Parent of a bucket: the transaction for the top level buckets or a bucket for nested buckets
+type container interface {
+	Bucket(name []byte) *bolt.Bucket
+	CreateBucket(name []byte) (*bolt.Bucket, error)
+	CreateBucketIfNotExists(name []byte) (*bolt.Bucket, error)
+	DeleteBucket(name []byte) error
+	Cursor() *bolt.Cursor
+}
+
+// Get the container of the last element of the bucket path and the name of that element.
+// If create is set, the missing buckets of the parent path are created. Buckets share their names
+// with the records of their parent, so an element that is the key of a record is an invalid path.
+func (tx *Tx) parent(bucket string, create bool) (c container, name []byte, err error) {
+
+	elems := SplitPath(bucket)
+	if len(elems) == 0 {
+		return nil, nil, ErrBucketDoesNotExist
+	}
+
+	for _, e := range elems {
+		if internal([]byte(e)) {
+			return nil, nil, ErrInvalidPath
+		}
+	}
+
+	c = tx.tx
+	for _, e := range elems[:len(elems)-1] {
+		if create {
+			if taken(c, []byte(e)) {
+				return nil, nil, ErrInvalidPath
+			}
+			if c, err = c.CreateBucketIfNotExists([]byte(e)); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		b := c.Bucket([]byte(e))
+		if b == nil {
+			return nil, nil, ErrBucketDoesNotExist
+		}
+		c = b
+	}
+
+	name = []byte(elems[len(elems)-1])
+	if create && (taken(c, name) || taken(c, inname(name))) {
+		return nil, nil, ErrInvalidPath
+	}
+
+	return c, name, nil
+}
+
+// Get the container of the bucket path itself. The empty path is the root.
+func (tx *Tx) container(bucket string) (container, error) {
+
+	if bucket == `` {
+		return tx.tx, nil
+	}
+
+	b, _, err := tx.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Call fn with the path, bucket and internal bucket of every bucket under the bucket path,
+// parents before their children
+func (tx *Tx) tree(bucket string, fn func(path string, b, inb *bolt.Bucket) error) error {
+
+	c, err := tx.container(bucket)
+	if err != nil {
+		return err
+	}
+
+	return descend(tx.ctx, c, SplitPath(bucket), fn)
+}
+
+// Recursively visit the buckets of a container until the context is done
+func descend(ctx context.Context, c container, path []string, fn func(path string, b, inb *bolt.Bucket) error) error {
+
+	for _, name := range children(c) {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		nb := []byte(name)
+		b := c.Bucket(nb)
+		p := append(path[:len(path):len(path)], name)
+
+		if err := fn(Path(p...), b, c.Bucket(inname(nb))); err != nil {
+			return err
+		}
+
+		if err := descend(ctx, b, p, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get the names of the buckets of a container, without internal buckets
+func children(c container) []string {
+
+	names := make([]string, 0)
+
+	cur := c.Cursor()
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if v == nil && !internal(k) {
+			names = append(names, string(k))
+		}
+	}
+
+	return names
+}
+
+// Check if the name is the key of a record of the container, so that no bucket can be created with it
+func taken(c container, name []byte) bool {
+	k, _ := c.Cursor().Seek(name)
+	return bytes.Equal(k, name) && c.Bucket(name) == nil
+}
+
+// Get the name of the internal bucket of a bucket
+func inname(name []byte) []byte {
+	return append([]byte(intBucket+`-`), name...)
+}
+
+// Check if the bucket name is an internal bucket
+func internal(name []byte) bool {
+	return bytes.HasPrefix(name, []byte(intBucket+`-`))
+}
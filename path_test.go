@@ -0,0 +1,204 @@
+package lokaldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		names []string
+		cnt   int
+		b     []byte
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	buckets := []string{
+		Path(`tenantA`),
+		Path(`tenantA`, `orders`),
+		Path(`tenantA`, `orders`, `created`),
+		Path(`tenantA`, `invoices`),
+		Path(`tenantB`, `orders`),
+		`tenantA.orders.created`,
+	}
+	for n, bucket := range buckets {
+		for i := 0; i <= n; i++ {
+			if err = db.Store(bucket, fmt.Sprintf("m%02d", i), []byte(bucket)); err != nil {
+				t.Fatalf("store: %s", err)
+			}
+		}
+	}
+
+	// Each level keeps its own records
+	if cnt, _ = db.Count(Path(`tenantA`, `orders`)); cnt != 2 {
+		t.Fatalf("count: got %d, want 2", cnt)
+	}
+	if b, err = db.SliceDown(Path(`tenantA`, `orders`, `created`)); err != nil || string(b) != Path(`tenantA`, `orders`, `created`) {
+		t.Fatalf("slice down: got %q, %v", b, err)
+	}
+
+	if names, _ = db.ListBuckets(); strings.Join(names, `,`) != `tenantA,tenantA.orders.created,tenantB` {
+		t.Fatalf("list buckets: got %v", names)
+	}
+	if names, _ = db.ListChildren(`tenantA`); strings.Join(names, `,`) != `invoices,orders` {
+		t.Fatalf("list children: got %v", names)
+	}
+
+	names, err = db.ListTree(`tenantA`)
+	if err != nil {
+		t.Fatalf("list tree: %s", err)
+	}
+	want := []string{Path(`tenantA`, `invoices`), Path(`tenantA`, `orders`), Path(`tenantA`, `orders`, `created`)}
+	if strings.Join(names, `,`) != strings.Join(want, `,`) {
+		t.Fatalf("list tree: got %q", names)
+	}
+
+	// 1 + 2 + (3 - 1) + 4
+	if cnt, err = db.CountTree(`tenantA`); err != nil || cnt != 9 {
+		t.Fatalf("count tree: got %d, %v", cnt, err)
+	}
+	if cnt, err = db.CountTree(``); err != nil || cnt != 20 {
+		t.Fatalf("count tree of the database: got %d, %v", cnt, err)
+	}
+
+	// Purge a whole tenant
+	if err = db.PurgeTree(`tenantA`); err != nil {
+		t.Fatalf("purge tree: %s", err)
+	}
+	if cnt, _ = db.CountTree(`tenantA`); cnt != 0 {
+		t.Fatalf("count tree after purge: got %d, want 0", cnt)
+	}
+	if names, _ = db.ListTree(`tenantA`); len(names) != 3 {
+		t.Fatalf("list tree after purge: got %q", names)
+	}
+	if cnt, _ = db.CountTree(`tenantB`); cnt != 5 {
+		t.Fatalf("count tree of another tenant: got %d, want 5", cnt)
+	}
+
+	// Move and drop a whole tenant
+	if err = db.RenameBucket(`tenantB`, Path(`archive`, `tenantB`)); err != nil {
+		t.Fatalf("rename: %s", err)
+	}
+	if cnt, _ = db.Count(Path(`archive`, `tenantB`, `orders`)); cnt != 5 {
+		t.Fatalf("count after rename: got %d, want 5", cnt)
+	}
+	if err = db.RenameBucket(`archive`, Path(`archive`, `old`)); err != ErrInvalidPath {
+		t.Fatalf("rename under itself: got %v, want %v", err, ErrInvalidPath)
+	}
+	if err = db.DropBucket(`tenantA`); err != nil {
+		t.Fatalf("drop: %s", err)
+	}
+	if names, _ = db.ListBuckets(); strings.Join(names, `,`) != `archive,tenantA.orders.created` {
+		t.Fatalf("list buckets after drop: got %v", names)
+	}
+}
+
+func TestPathClashes(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		cnt int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.Store(Path(`a`, `b`), `m01`, []byte(`1`)); err != nil {
+		t.Fatalf("store child: %s", err)
+	}
+	if err = db.Store(`a`, `m01`, []byte(`1`)); err != nil {
+		t.Fatalf("store parent: %s", err)
+	}
+
+	// Records cannot take the names of the buckets under their bucket
+	if err = db.Store(`a`, `b`, []byte(`2`)); !errors.Is(err, ErrBucketExists) {
+		t.Fatalf("store child name: got %v, want %v", err, ErrBucketExists)
+	}
+	for _, key := range []string{intBucket + `-b`, intBucket + `-c`} {
+		if err = db.Store(`a`, key, []byte(`2`)); !errors.Is(err, ErrInvalidPath) {
+			t.Fatalf("store internal name %q: got %v, want %v", key, err, ErrInvalidPath)
+		}
+	}
+
+	// Buckets cannot be created through or on the keys of records
+	if err = db.Store(Path(`a`, `m01`), `m01`, []byte(`3`)); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("store under record: got %v, want %v", err, ErrInvalidPath)
+	}
+	if err = db.Store(Path(`a`, `m01`, `c`), `m01`, []byte(`3`)); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("store through record: got %v, want %v", err, ErrInvalidPath)
+	}
+	if err = db.RenameBucket(Path(`a`, `b`), Path(`a`, `m01`)); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("rename onto record: got %v, want %v", err, ErrInvalidPath)
+	}
+	if err = db.Store(Path(`a`, intBucket+`-b`), `m01`, []byte(`3`)); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("store internal path: got %v, want %v", err, ErrInvalidPath)
+	}
+
+	if cnt, err = db.CountTree(`a`); err != nil || cnt != 2 {
+		t.Fatalf("count tree: got %d %v, want 2", cnt, err)
+	}
+}
+
+func TestPathContext(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		cnt int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for _, bucket := range []string{`tenantA`, Path(`tenantA`, `orders`), Path(`tenantA`, `invoices`)} {
+		for i := 0; i < 3; i++ {
+			if err = db.Store(bucket, fmt.Sprintf("m%02d", i), []byte(bucket)); err != nil {
+				t.Fatalf("store: %s", err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = db.ListChildrenCtx(ctx, `tenantA`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("list children: got %v, want %v", err, context.Canceled)
+	}
+	if _, err = db.ListTreeCtx(ctx, ``); !errors.Is(err, context.Canceled) {
+		t.Fatalf("list tree: got %v, want %v", err, context.Canceled)
+	}
+	if _, err = db.CountTreeCtx(ctx, `tenantA`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("count tree: got %v, want %v", err, context.Canceled)
+	}
+	if err = db.PurgeTreeCtx(ctx, `tenantA`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("purge tree: got %v, want %v", err, context.Canceled)
+	}
+
+	// A context done in the middle of a purge rolls it back
+	ctx, cancel = context.WithCancel(context.Background())
+	err = db.UpdateCtx(ctx, func(tx *Tx) error {
+		cancel()
+		return tx.PurgeTree(`tenantA`)
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("purge tree cancelled: got %v, want %v", err, context.Canceled)
+	}
+	if cnt, err = db.CountTree(`tenantA`); err != nil || cnt != 9 {
+		t.Fatalf("count tree after cancel: got %d %v, want 9", cnt, err)
+	}
+}
@@ -0,0 +1,109 @@
+package lokaldb
+
+import (
+	"context"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// PeekHead gets the record at the top of the bucket, the next one in FIFO order, without removing it.
+// The boolean is false if the bucket is empty.
+func (db *LokalDB) PeekHead(bucket string) (ChunkData, bool, error) {
+	return db.PeekHeadCtx(context.Background(), bucket)
+}
+
+// PeekHeadCtx is PeekHead with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) PeekHeadCtx(ctx context.Context, bucket string) (kv ChunkData, ok bool, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		kv, ok, err = tx.PeekHead(bucket)
+		return
+	})
+	if err != nil {
+		return ChunkData{}, false, err
+	}
+	return
+}
+
+// PeekTail gets the record at the bottom of the bucket, the next one in LIFO order, without removing it.
+// The boolean is false if the bucket is empty.
+func (db *LokalDB) PeekTail(bucket string) (ChunkData, bool, error) {
+	return db.PeekTailCtx(context.Background(), bucket)
+}
+
+// PeekTailCtx is PeekTail with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) PeekTailCtx(ctx context.Context, bucket string) (kv ChunkData, ok bool, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		kv, ok, err = tx.PeekTail(bucket)
+		return
+	})
+	if err != nil {
+		return ChunkData{}, false, err
+	}
+	return
+}
+
+// PeekHead gets the record at the top of the bucket without removing it. The boolean is false if the bucket is empty.
+func (tx *Tx) PeekHead(bucket string) (ChunkData, bool, error) {
+	return tx.peek(bucket, true)
+}
+
+// PeekTail gets the record at the bottom of the bucket without removing it. The boolean is false if the bucket is empty.
+func (tx *Tx) PeekTail(bucket string) (ChunkData, bool, error) {
+	return tx.peek(bucket, false)
+}
+
+// Get the first or last record. The first and last indexes always point to a record
+// while the bucket is not empty, so the index is only walked for databases written by earlier versions
+// or when the record is reserved by a lease or not due yet.
+func (tx *Tx) peek(bucket string, forward bool) (ChunkData, bool, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		idx    int
+		keyb   []byte
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return ChunkData{}, false, err
+	}
+
+	if forward {
+		idx = getint(inb, recFirstIdxKey)
+	} else {
+		idx = getint(inb, recLastIdxKey)
+	}
+
+	now := tx.now()
+	if keyb = inb.Get([]byte(strconv.Itoa(idx))); (keyb == nil || !visible(inb, keyb, now)) && getint(inb, recCntKey) > 0 {
+		idx, keyb = next(inb, forward, now)
+	}
+	if keyb == nil {
+		return ChunkData{}, false, nil
+	}
+
+	return record(b, inb, keyb, idx), true, nil
+}
+
+// PeekHead gets the item at the top of the queue without removing it. The boolean is false if the queue is empty.
+func (q *Queue[T]) PeekHead() (Item[T], bool, error) {
+	return q.one(q.db.View, func(tx *Tx) ([]ChunkData, error) {
+		kv, ok, err := tx.PeekHead(q.bucket)
+		if !ok {
+			return nil, err
+		}
+		return []ChunkData{kv}, nil
+	})
+}
+
+// PeekTail gets the item at the bottom of the queue without removing it. The boolean is false if the queue is empty.
+func (q *Queue[T]) PeekTail() (Item[T], bool, error) {
+	return q.one(q.db.View, func(tx *Tx) ([]ChunkData, error) {
+		kv, ok, err := tx.PeekTail(q.bucket)
+		if !ok {
+			return nil, err
+		}
+		return []ChunkData{kv}, nil
+	})
+}
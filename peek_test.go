@@ -0,0 +1,77 @@
+package lokaldb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeek(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		kv  ChunkData
+		ok  bool
+		cnt int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if _, _, err = db.PeekHead(`default`); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("peek missing bucket: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("m%02d", i), []byte(fmt.Sprintf("%d", i))); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	// Leave gaps in the index at both ends
+	if err = db.DeleteOnce(`default`, []string{`m01`, `m02`, `m05`}); err != nil {
+		t.Fatalf("delete once: %s", err)
+	}
+
+	if kv, ok, err = db.PeekHead(`default`); err != nil || !ok || kv.Key != `m03` || kv.Seq != 3 {
+		t.Fatalf("peek head: got %+v, %t, %v", kv, ok, err)
+	}
+	if kv, ok, err = db.PeekTail(`default`); err != nil || !ok || kv.Key != `m04` || string(kv.Value) != `4` {
+		t.Fatalf("peek tail: got %+v, %t, %v", kv, ok, err)
+	}
+
+	// Peeking does not remove anything
+	if cnt, _ = db.Count(`default`); cnt != 2 {
+		t.Fatalf("count: got %d, want 2", cnt)
+	}
+
+	// Inspect the head and commit the slice only if it is the same record
+	err = db.Update(func(tx *Tx) error {
+		kv, ok, err := tx.PeekHead(`default`)
+		if err != nil || !ok {
+			return err
+		}
+		kv2, err := tx.SliceDownRecord(`default`)
+		if err == nil && kv2.Key != kv.Key {
+			err = fmt.Errorf("slice down: got %s, want %s", kv2.Key, kv.Key)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("update: %s", err)
+	}
+
+	if _, err = db.CutChunkDown(`default`, 0); err != nil {
+		t.Fatalf("cut chunk down: %s", err)
+	}
+	if kv, ok, err = db.PeekHead(`default`); err != nil || ok || kv.Key != `` {
+		t.Fatalf("peek head empty: got %+v, %t, %v", kv, ok, err)
+	}
+	if kv, ok, err = db.PeekTail(`default`); err != nil || ok || kv.Key != `` {
+		t.Fatalf("peek tail empty: got %+v, %t, %v", kv, ok, err)
+	}
+}
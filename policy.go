@@ -0,0 +1,146 @@
+package lokaldb
+
+import (
+	"context"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// OverwritePolicy is what happens to the position of a record when its key is stored again
+type OverwritePolicy int
+
+// Overwrite policies
+const (
+	BucketPolicy    OverwritePolicy = iota // Use the policy of the bucket. This is only valid for a single call.
+	KeepPosition                           // The record keeps its position in the queue. This is the default.
+	MoveToTail                             // The record is moved to the bottom of the queue and gets a new sequence number
+	RejectOverwrite                        // The store fails with ErrConflict
+)
+
+// Name of the bucket inside the internal bucket that keeps the configuration of the bucket
+var recConfBucket []byte = []byte(`Zq0CVB8iY4qw2oF5WJKB`)
+
+// Configuration keys
+var confOverwriteKey []byte = []byte(`overwrite`)
+
+// StoreWithPolicy inserts data in the local database like Store, using the overwrite policy instead of the one of the bucket.
+// A policy that is not one of the overwrite policies returns ErrInvalidPolicy.
+func (db *LokalDB) StoreWithPolicy(bucket string, key string, data []byte, policy OverwritePolicy) error {
+	return db.StoreWithPolicyCtx(context.Background(), bucket, key, data, policy)
+}
+
+// StoreWithPolicyCtx is StoreWithPolicy with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreWithPolicyCtx(ctx context.Context, bucket string, key string, data []byte, policy OverwritePolicy) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.StoreWithPolicy(bucket, key, data, policy)
+	})
+}
+
+// SetOverwritePolicy sets the overwrite policy of the bucket. The bucket is created if it does not exist.
+// BucketPolicy resets the bucket to the default policy.
+func (db *LokalDB) SetOverwritePolicy(bucket string, policy OverwritePolicy) error {
+	return db.SetOverwritePolicyCtx(context.Background(), bucket, policy)
+}
+
+// SetOverwritePolicyCtx is SetOverwritePolicy with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) SetOverwritePolicyCtx(ctx context.Context, bucket string, policy OverwritePolicy) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.SetOverwritePolicy(bucket, policy)
+	})
+}
+
+// OverwritePolicy gets the overwrite policy of the bucket
+func (db *LokalDB) OverwritePolicy(bucket string) (OverwritePolicy, error) {
+	return db.OverwritePolicyCtx(context.Background(), bucket)
+}
+
+// OverwritePolicyCtx is OverwritePolicy with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) OverwritePolicyCtx(ctx context.Context, bucket string) (policy OverwritePolicy, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		policy, err = tx.OverwritePolicy(bucket)
+		return
+	})
+	if err != nil {
+		return KeepPosition, err
+	}
+	return
+}
+
+// StoreWithPolicy inserts data in the bucket like Store, using the overwrite policy instead of the one of the bucket
+func (tx *Tx) StoreWithPolicy(bucket string, key string, data []byte, policy OverwritePolicy) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if policy < BucketPolicy || policy > RejectOverwrite {
+		return ErrInvalidPolicy
+	}
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	return put(b, inb, []byte(key), data, nil, policy, tx.indexes(bucket), tx.now())
+}
+
+// SetOverwritePolicy sets the overwrite policy of the bucket. The bucket is created if it does not exist.
+func (tx *Tx) SetOverwritePolicy(bucket string, policy OverwritePolicy) error {
+
+	var (
+		err  error
+		inb  *bolt.Bucket
+		conf *bolt.Bucket
+	)
+
+	if policy < BucketPolicy || policy > RejectOverwrite {
+		return ErrInvalidPolicy
+	}
+
+	if _, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	if conf, err = inb.CreateBucketIfNotExists(recConfBucket); err != nil {
+		return err
+	}
+
+	if policy == BucketPolicy {
+		return conf.Delete(confOverwriteKey)
+	}
+
+	return conf.Put(confOverwriteKey, []byte(strconv.Itoa(int(policy))))
+}
+
+// OverwritePolicy gets the overwrite policy of the bucket
+func (tx *Tx) OverwritePolicy(bucket string) (OverwritePolicy, error) {
+
+	var (
+		err error
+		inb *bolt.Bucket
+	)
+
+	if _, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return KeepPosition, err
+	}
+
+	return overwritePolicy(inb, BucketPolicy), nil
+}
+
+// Resolve the overwrite policy of a store. BucketPolicy gets the policy of the bucket.
+func overwritePolicy(inb *bolt.Bucket, policy OverwritePolicy) OverwritePolicy {
+
+	if policy != BucketPolicy {
+		return policy
+	}
+
+	if conf := inb.Bucket(recConfBucket); conf != nil {
+		if p, _ := strconv.Atoi(string(conf.Get(confOverwriteKey))); p > int(BucketPolicy) {
+			return OverwritePolicy(p)
+		}
+	}
+
+	return KeepPosition
+}
@@ -0,0 +1,177 @@
+package lokaldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverwritePolicy(t *testing.T) {
+	var (
+		err    error
+		db     *LokalDB
+		chunk  []ChunkData
+		cnt    int
+		policy OverwritePolicy
+		data   []byte
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 3; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("k%02d", i), []byte(`v1`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	// The default keeps the position and does not count the record again
+	if err = db.Store(`default`, `k01`, []byte(`v2`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if chunk, _ = db.FetchChunkDown(`default`, 0, 0); keysOf(chunk) != `k01 k02 k03 ` {
+		t.Fatalf("keep position: got %s", keysOf(chunk))
+	}
+	if cnt, _ = db.Count(`default`); cnt != 3 {
+		t.Fatalf("count after keep position: got %d, want 3", cnt)
+	}
+
+	// Moving the head to the tail
+	if err = db.StoreWithPolicy(`default`, `k01`, []byte(`v3`), MoveToTail); err != nil {
+		t.Fatalf("store with policy: %s", err)
+	}
+	if chunk, _ = db.FetchChunkDown(`default`, 0, 0); keysOf(chunk) != `k02 k03 k01 ` || chunk[2].Seq != 4 {
+		t.Fatalf("move to tail: got %s", keysOf(chunk))
+	}
+	if cnt, _ = db.Count(`default`); cnt != 3 {
+		t.Fatalf("count after move to tail: got %d, want 3", cnt)
+	}
+	if chunk, _ = db.FetchChunkUp(`default`, 0, 0); keysOf(chunk) != `k01 k03 k02 ` {
+		t.Fatalf("move to tail backward: got %s", keysOf(chunk))
+	}
+
+	// The policy of the bucket applies to Store
+	if err = db.SetOverwritePolicy(`default`, RejectOverwrite); err != nil {
+		t.Fatalf("set overwrite policy: %s", err)
+	}
+	if policy, _ = db.OverwritePolicy(`default`); policy != RejectOverwrite {
+		t.Fatalf("overwrite policy: got %d, want %d", policy, RejectOverwrite)
+	}
+	if err = db.Store(`default`, `k02`, []byte(`v2`)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("store rejected: got %v, want %v", err, ErrConflict)
+	}
+	if data, _ = db.Fetch(`default`, `k02`); string(data) != `v1` {
+		t.Fatalf("fetch after reject: got %q, want %q", data, `v1`)
+	}
+	if err = db.Store(`default`, `k04`, []byte(`v1`)); err != nil {
+		t.Fatalf("store new key: %s", err)
+	}
+
+	// A call can override the policy of the bucket
+	if err = db.StoreWithPolicy(`default`, `k02`, []byte(`v2`), KeepPosition); err != nil {
+		t.Fatalf("store with policy: %s", err)
+	}
+
+	// The policy survives a purge
+	if err = db.PurgeBucket(`default`); err != nil {
+		t.Fatalf("purge: %s", err)
+	}
+	if policy, _ = db.OverwritePolicy(`default`); policy != RejectOverwrite {
+		t.Fatalf("overwrite policy after purge: got %d, want %d", policy, RejectOverwrite)
+	}
+
+	if err = db.SetOverwritePolicy(`default`, MoveToTail); err != nil {
+		t.Fatalf("set overwrite policy: %s", err)
+	}
+	for _, k := range []string{`a1`, `a2`, `a1`, `a3`, `a2`} {
+		if err = db.Store(`default`, k, []byte(k)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+	if chunk, _ = db.CutChunkDown(`default`, 0); keysOf(chunk) != `a1 a3 a2 ` {
+		t.Fatalf("cut after moves: got %s", keysOf(chunk))
+	}
+	if cnt, _ = db.Count(`default`); cnt != 0 {
+		t.Fatalf("count after cut: got %d, want 0", cnt)
+	}
+
+	if err = db.SetOverwritePolicy(`default`, OverwritePolicy(42)); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("set invalid policy: got %v, want %v", err, ErrInvalidPolicy)
+	}
+	for _, policy := range []OverwritePolicy{-1, 42} {
+		if err = db.StoreWithPolicy(`default`, `a1`, []byte(`x`), policy); !errors.Is(err, ErrInvalidPolicy) {
+			t.Fatalf("store with invalid policy %d: got %v, want %v", policy, err, ErrInvalidPolicy)
+		}
+	}
+	if cnt, _ = db.Count(`default`); cnt != 0 {
+		t.Fatalf("count after invalid policy: got %d, want 0", cnt)
+	}
+}
+
+// Read and delete from a bucket that has no record
+func checkEmpty(t *testing.T, db *LokalDB, bucket string) {
+	t.Helper()
+
+	if chunk, err := db.FetchChunkDown(bucket, 0, 0); err != nil || len(chunk) != 0 {
+		t.Fatalf("fetch chunk down %q: got %q %v, want nothing", bucket, keysOf(chunk), err)
+	}
+	if chunk, err := db.FetchChunkUp(bucket, 0, 0); err != nil || len(chunk) != 0 {
+		t.Fatalf("fetch chunk up %q: got %q %v, want nothing", bucket, keysOf(chunk), err)
+	}
+	if err := db.Delete(bucket, `x`); err != nil {
+		t.Fatalf("delete %q: %s", bucket, err)
+	}
+	if err := db.DeleteOnce(bucket, []string{`x`}); err != nil {
+		t.Fatalf("delete once %q: %s", bucket, err)
+	}
+	if data, err := db.FetchDelete(bucket, `x`); err != nil || data != nil {
+		t.Fatalf("fetch delete %q: got %q %v, want nil", bucket, data, err)
+	}
+
+	// The first record still gets the first position
+	if err := db.Store(bucket, `m01`, []byte(`1`)); err != nil {
+		t.Fatalf("store %q: %s", bucket, err)
+	}
+	if kv, err := db.FetchBySeq(bucket, 1); err != nil || kv.Key != `m01` {
+		t.Fatalf("fetch by seq %q: got %q %v, want m01", bucket, kv.Key, err)
+	}
+}
+
+func TestOverwritePolicyEmpty(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	// Setting the policy creates the bucket without records
+	if err = db.SetOverwritePolicy(`b`, MoveToTail); err != nil {
+		t.Fatalf("set policy: %s", err)
+	}
+	checkEmpty(t, db, `b`)
+}
+
+func TestOverwritePolicyContext(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = db.SetOverwritePolicyCtx(ctx, `default`, MoveToTail); !errors.Is(err, context.Canceled) {
+		t.Fatalf("set policy: got %v, want %v", err, context.Canceled)
+	}
+	if _, err = db.OverwritePolicyCtx(ctx, `default`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("policy: got %v, want %v", err, context.Canceled)
+	}
+	if exists, _ := db.BucketExists(`default`); exists {
+		t.Fatalf("set policy cancelled: bucket was created")
+	}
+}
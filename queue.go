@@ -0,0 +1,219 @@
+package lokaldb
+
+import (
+	"iter"
+)
+
+// Item is a typed record of a queue
+type Item[T any] struct {
+	Key   string
+	Value T
+	Seq   uint64 // Position of the record in its bucket
+	Envelope
+}
+
+// Queue is a typed view of a bucket. Values are encoded and decoded with its codec.
+//
+// Operations that remove records decode them inside the transaction. If a value cannot be decoded,
+// a *DecodeError with its key is returned and nothing is removed.
+type Queue[T any] struct {
+	db     *LokalDB
+	bucket string
+	codec  Codec[T]
+}
+
+// NewQueue creates a typed queue on the bucket of the local database
+//
+//	orders := lokaldb.NewQueue(db, `orders`, lokaldb.JSONCodec[Order]{})
+func NewQueue[T any](db *LokalDB, bucket string, codec Codec[T]) *Queue[T] {
+	return &Queue[T]{
+		db:     db,
+		bucket: bucket,
+		codec:  codec,
+	}
+}
+
+// Bucket returns the bucket of the queue
+func (q *Queue[T]) Bucket() string {
+	return q.bucket
+}
+
+// Store inserts the value in the queue. It will update records containing the same key with the current value.
+func (q *Queue[T]) Store(key string, v T) error {
+
+	data, err := q.encode(key, v)
+	if err != nil {
+		return err
+	}
+
+	return q.db.Store(q.bucket, key, data)
+}
+
+// StoreOnce inserts the items in the queue in one transaction
+func (q *Queue[T]) StoreOnce(items []Item[T]) error {
+
+	chunk := make([]ChunkData, 0, len(items))
+	for _, it := range items {
+		data, err := q.encode(it.Key, it.Value)
+		if err != nil {
+			return err
+		}
+		chunk = append(chunk, ChunkData{Key: it.Key, Value: data, Envelope: it.Envelope})
+	}
+
+	return q.db.StoreOnce(q.bucket, chunk)
+}
+
+// Fetch gets the value with the provided key. The boolean is false if the record does not exist.
+func (q *Queue[T]) Fetch(key string) (v T, ok bool, err error) {
+	err = q.db.View(func(tx *Tx) error {
+		data, err := tx.Fetch(q.bucket, key)
+		if err != nil || data == nil {
+			return err
+		}
+		v, err = q.decode(key, data)
+		ok = err == nil
+		return err
+	})
+	return
+}
+
+// Delete a single record in the queue that matches the provided key
+func (q *Queue[T]) Delete(key string) error {
+	return q.db.Delete(q.bucket, key)
+}
+
+// DeleteOnce remove records in the queue in one go
+func (q *Queue[T]) DeleteOnce(keys []string) error {
+	return q.db.DeleteOnce(q.bucket, keys)
+}
+
+// FetchDelete gets the value with the provided key and deletes it. The boolean is false if the record does not exist.
+func (q *Queue[T]) FetchDelete(key string) (v T, ok bool, err error) {
+	err = q.db.Update(func(tx *Tx) error {
+		data, err := tx.FetchDelete(q.bucket, key)
+		if err != nil || data == nil {
+			return err
+		}
+		v, err = q.decode(key, data)
+		ok = err == nil
+		return err
+	})
+	return
+}
+
+// FetchChunkUp gets a chunk of items starting from the bottom to top limited by max
+func (q *Queue[T]) FetchChunkUp(max int, offset int) ([]Item[T], error) {
+	return q.chunk(q.db.View, func(tx *Tx) ([]ChunkData, error) {
+		return tx.FetchChunkUp(q.bucket, max, offset)
+	})
+}
+
+// FetchChunkDown gets a chunk of items starting from the top to bottom limited by max
+func (q *Queue[T]) FetchChunkDown(max int, offset int) ([]Item[T], error) {
+	return q.chunk(q.db.View, func(tx *Tx) ([]ChunkData, error) {
+		return tx.FetchChunkDown(q.bucket, max, offset)
+	})
+}
+
+// SliceUp fetches and deletes an item from bottom to top. The boolean is false if the queue is empty.
+func (q *Queue[T]) SliceUp() (Item[T], bool, error) {
+	return q.one(q.db.Update, func(tx *Tx) ([]ChunkData, error) {
+		return tx.CutChunkUp(q.bucket, 1)
+	})
+}
+
+// SliceDown fetches and deletes an item from top to bottom. The boolean is false if the queue is empty.
+func (q *Queue[T]) SliceDown() (Item[T], bool, error) {
+	return q.one(q.db.Update, func(tx *Tx) ([]ChunkData, error) {
+		return tx.CutChunkDown(q.bucket, 1)
+	})
+}
+
+// CutChunkUp gets a chunk of items starting from bottom to top in descending order and removes them
+func (q *Queue[T]) CutChunkUp(max int) ([]Item[T], error) {
+	return q.chunk(q.db.Update, func(tx *Tx) ([]ChunkData, error) {
+		return tx.CutChunkUp(q.bucket, max)
+	})
+}
+
+// CutChunkDown gets a chunk of items starting from top to bottom in ascending order and removes them
+func (q *Queue[T]) CutChunkDown(max int) ([]Item[T], error) {
+	return q.chunk(q.db.Update, func(tx *Tx) ([]ChunkData, error) {
+		return tx.CutChunkDown(q.bucket, max)
+	})
+}
+
+// Count records in the queue
+func (q *Queue[T]) Count() (int, error) {
+	return q.db.Count(q.bucket)
+}
+
+// All returns an iterator over the items of the queue from top to bottom (FIFO).
+// Iteration stops at a value that cannot be decoded; the error is yielded with its key.
+func (q *Queue[T]) All() iter.Seq2[Item[T], error] {
+	return func(yield func(Item[T], error) bool) {
+		for key, data := range q.db.All(q.bucket) {
+			v, err := q.decode(key, data)
+			if !yield(Item[T]{Key: key, Value: v}, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Run a chunk operation in a transaction and decode its records
+func (q *Queue[T]) chunk(run func(func(tx *Tx) error) error, op func(tx *Tx) ([]ChunkData, error)) (items []Item[T], err error) {
+	err = run(func(tx *Tx) error {
+		chunk, err := op(tx)
+		if err != nil {
+			return err
+		}
+		items = make([]Item[T], 0, len(chunk))
+		for _, kv := range chunk {
+			v, err := q.decode(kv.Key, kv.Value)
+			if err != nil {
+				return err
+			}
+			items = append(items, Item[T]{Key: kv.Key, Value: v, Seq: kv.Seq, Envelope: kv.Envelope})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Run an operation on one record in a transaction and decode it
+func (q *Queue[T]) one(run func(func(tx *Tx) error) error, op func(tx *Tx) ([]ChunkData, error)) (Item[T], bool, error) {
+
+	items, err := q.chunk(run, op)
+	if err != nil || len(items) == 0 {
+		return Item[T]{}, false, err
+	}
+
+	return items[0], true, nil
+}
+
+// Encode a value with the codec
+func (q *Queue[T]) encode(key string, v T) ([]byte, error) {
+
+	data, err := q.codec.Encode(v)
+	if err != nil {
+		return nil, &EncodeError{Bucket: q.bucket, Key: key, Err: err}
+	}
+
+	return data, nil
+}
+
+// Decode a value with the codec
+func (q *Queue[T]) decode(key string, data []byte) (T, error) {
+
+	v, err := q.codec.Decode(data)
+	if err != nil {
+		return v, &DecodeError{Bucket: q.bucket, Key: key, Err: err}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,120 @@
+package lokaldb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+type order struct {
+	ID     int
+	Symbol string
+	Qty    float64
+}
+
+func TestQueue(t *testing.T) {
+
+	for name, codec := range map[string]Codec[order]{
+		`json`: JSONCodec[order]{},
+		`gob`:  GobCodec[order]{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				err   error
+				db    *LokalDB
+				items []Item[order]
+				it    Item[order]
+				o     order
+				ok    bool
+			)
+
+			db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+			if err != nil {
+				t.Fatalf("open: %s", err)
+			}
+			defer db.Close()
+
+			q := NewQueue(db, `orders`, codec)
+
+			for i := 0; i < 5; i++ {
+				if err = q.Store(fmt.Sprintf("o%02d", i), order{ID: i, Symbol: `ACME`, Qty: float64(i) * 1.5}); err != nil {
+					t.Fatalf("store: %s", err)
+				}
+			}
+
+			if o, ok, err = q.Fetch(`o03`); err != nil || !ok || o.ID != 3 || o.Qty != 4.5 {
+				t.Fatalf("fetch: got %+v, %v, %v", o, ok, err)
+			}
+			if _, ok, err = q.Fetch(`missing`); err != nil || ok {
+				t.Fatalf("fetch missing: got %v, %v", ok, err)
+			}
+
+			if items, err = q.FetchChunkUp(2, 0); err != nil || len(items) != 2 || items[0].Value.ID != 4 {
+				t.Fatalf("fetch chunk up: got %+v, %v", items, err)
+			}
+
+			if it, ok, err = q.SliceDown(); err != nil || !ok || it.Key != `o00` || it.Value.ID != 0 {
+				t.Fatalf("slice down: got %+v, %v, %v", it, ok, err)
+			}
+
+			if items, err = q.CutChunkDown(2); err != nil || len(items) != 2 || items[1].Value.ID != 2 {
+				t.Fatalf("cut chunk down: got %+v, %v", items, err)
+			}
+
+			cnt := 0
+			for it, err := range q.All() {
+				if err != nil {
+					t.Fatalf("all: %s", err)
+				}
+				if it.Value.Symbol != `ACME` {
+					t.Fatalf("all: got %+v", it)
+				}
+				cnt++
+			}
+			if cnt != 2 {
+				t.Fatalf("all: got %d items, want 2", cnt)
+			}
+		})
+	}
+}
+
+func TestQueueDecodeError(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		derr  *DecodeError
+		items []Item[order]
+		cnt   int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	q := NewQueue(db, `orders`, JSONCodec[order]{})
+
+	if err = q.Store(`o00`, order{ID: 0}); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if err = db.Store(`orders`, `poison`, []byte(`{not json`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+
+	// A value that cannot be decoded fails the cut and removes nothing
+	if items, err = q.CutChunkDown(0); !errors.As(err, &derr) || derr.Key != `poison` || items != nil {
+		t.Fatalf("cut chunk down: got %v, %v", items, err)
+	}
+	if cnt, _ = q.Count(); cnt != 2 {
+		t.Fatalf("count: got %d, want 2", cnt)
+	}
+
+	if err = q.Delete(derr.Key); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if items, err = q.CutChunkDown(0); err != nil || len(items) != 1 {
+		t.Fatalf("cut chunk down after delete: got %v, %v", items, err)
+	}
+}
@@ -0,0 +1,147 @@
+package lokaldb
+
+import (
+	"bytes"
+	"context"
+	"iter"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ScanPrefix returns an iterator over the records of the bucket whose keys start with the prefix,
+// in ascending order of their keys. A limit of zero yields all of them.
+//
+// Like All, records are read in pages in short read-only transactions. A missing bucket yields nothing.
+//
+//	for key, value := range db.ScanPrefix(`orders`, `order-123:`, 100) {
+//		...
+//	}
+func (db *LokalDB) ScanPrefix(bucket string, prefix string, limit int) iter.Seq2[string, []byte] {
+	return db.scan(bucket, []byte(prefix), func(k []byte) bool {
+		return bytes.HasPrefix(k, []byte(prefix))
+	}, limit)
+}
+
+// ScanRange returns an iterator over the records of the bucket with keys from start, included,
+// to end, excluded, in ascending order of their keys. An empty end scans to the last key.
+// A limit of zero yields all of them.
+func (db *LokalDB) ScanRange(bucket string, start string, end string, limit int) iter.Seq2[string, []byte] {
+	return db.scan(bucket, []byte(start), func(k []byte) bool {
+		return end == `` || bytes.Compare(k, []byte(end)) < 0
+	}, limit)
+}
+
+// DeletePrefix removes the records of the bucket whose keys start with the prefix. It returns the number of records removed.
+func (db *LokalDB) DeletePrefix(bucket string, prefix string) (int, error) {
+	return db.DeletePrefixCtx(context.Background(), bucket, prefix)
+}
+
+// DeletePrefixCtx is DeletePrefix with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) DeletePrefixCtx(ctx context.Context, bucket string, prefix string) (n int, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		n, err = tx.DeletePrefix(bucket, prefix)
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// DeletePrefix removes the records of the bucket whose keys start with the prefix. It returns the number of records removed.
+func (tx *Tx) DeletePrefix(bucket string, prefix string) (int, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		keys   [][]byte
+		pfx    = []byte(prefix)
+	)
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return 0, err
+	}
+
+	c := b.Cursor()
+	for k, v := c.Seek(pfx); k != nil && bytes.HasPrefix(k, pfx); k, v = c.Next() {
+		if err = tx.ctx.Err(); err != nil {
+			return 0, err
+		}
+		// Nested buckets are not records
+		if v == nil {
+			continue
+		}
+		keys = append(keys, bytes.Clone(k))
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	if err = remove(b, inb, keys...); err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
+
+// Iterate over the records of the bucket in key order from the key while in returns true,
+// one page per read-only transaction
+func (db *LokalDB) scan(bucket string, from []byte, in func(k []byte) bool, limit int) iter.Seq2[string, []byte] {
+	return func(yield func(string, []byte) bool) {
+
+		var (
+			err   error
+			chunk []ChunkData
+			more  bool
+			n     int
+		)
+
+		for {
+			err = db.View(func(tx *Tx) error {
+
+				b, inb, err := tx.bucket(bucket)
+				if err != nil {
+					return err
+				}
+
+				chunk, more = chunk[:0], false
+				now := tx.now()
+				c := b.Cursor()
+				for k, v := c.Seek(from); k != nil; k, v = c.Next() {
+					if !in(k) {
+						return nil
+					}
+					if v == nil || expired(inb, k, now) {
+						continue
+					}
+					if len(chunk) == iterPageSize {
+						more = true
+						return nil
+					}
+					chunk = append(chunk, ChunkData{Key: string(k), Value: value(b, inb, k)})
+				}
+				return nil
+			})
+			if err != nil {
+				return
+			}
+
+			for _, kv := range chunk {
+				if !yield(kv.Key, kv.Value) {
+					return
+				}
+				if n++; limit > 0 && n >= limit {
+					return
+				}
+			}
+
+			if !more {
+				return
+			}
+
+			// Continue after the last key of the page
+			from = append([]byte(chunk[len(chunk)-1].Key), 0)
+		}
+	}
+}
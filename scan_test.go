@@ -0,0 +1,92 @@
+package lokaldb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScans(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		cnt   int
+		n     int
+		keys  []string
+		chunk []ChunkData
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	// Interleave the orders so that key order differs from insertion order
+	kv := make([]ChunkData, 0, 900)
+	for i := 0; i < 300; i++ {
+		for _, o := range []string{`order-b`, `order-a`, `order-c`} {
+			kv = append(kv, ChunkData{Key: fmt.Sprintf("%s:%03d", o, i), Value: []byte(o)})
+		}
+	}
+	if err = db.StoreOnce(`default`, kv); err != nil {
+		t.Fatalf("store once: %s", err)
+	}
+
+	// A child bucket is not a record
+	if err = db.Store(Path(`default`, `order-a:child`), `key`, []byte(`data`)); err != nil {
+		t.Fatalf("store child: %s", err)
+	}
+
+	prev := ``
+	cnt = 0
+	for key, value := range db.ScanPrefix(`default`, `order-a:`, 0) {
+		if key <= prev || !strings.HasPrefix(key, `order-a:`) || string(value) != `order-a` {
+			t.Fatalf("scan prefix: %s yielded after %s", key, prev)
+		}
+		prev = key
+		cnt++
+	}
+	if cnt != 300 {
+		t.Fatalf("scan prefix: got %d records, want 300", cnt)
+	}
+
+	keys = keys[:0]
+	for key := range db.ScanPrefix(`default`, `order-c:`, 3) {
+		keys = append(keys, key)
+	}
+	if strings.Join(keys, ` `) != `order-c:000 order-c:001 order-c:002` {
+		t.Fatalf("scan prefix with limit: got %v", keys)
+	}
+
+	keys = keys[:0]
+	for key := range db.ScanRange(`default`, `order-a:298`, `order-b:001`, 0) {
+		keys = append(keys, key)
+	}
+	if strings.Join(keys, ` `) != `order-a:298 order-a:299 order-b:000` {
+		t.Fatalf("scan range: got %v", keys)
+	}
+
+	cnt = 0
+	for range db.ScanRange(`default`, `order-b`, ``, 0) {
+		cnt++
+	}
+	if cnt != 600 {
+		t.Fatalf("scan range to the end: got %d records, want 600", cnt)
+	}
+
+	// Deleting a prefix keeps the index and the count in sync
+	if n, err = db.DeletePrefix(`default`, `order-b:`); err != nil || n != 300 {
+		t.Fatalf("delete prefix: got %d, %v", n, err)
+	}
+	if cnt, _ = db.Count(`default`); cnt != 600 {
+		t.Fatalf("count: got %d, want 600", cnt)
+	}
+	if chunk, err = db.FetchChunkDown(`default`, 2, 0); err != nil || keysOf(chunk) != `order-a:000 order-c:000 ` {
+		t.Fatalf("fetch chunk down: got %s, %v", keysOf(chunk), err)
+	}
+	if n, err = db.DeletePrefix(`default`, `order-b:`); err != nil || n != 0 {
+		t.Fatalf("delete missing prefix: got %d, %v", n, err)
+	}
+}
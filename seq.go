@@ -0,0 +1,157 @@
+package lokaldb
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FetchBySeq gets the record with the sequence number. If there is none, the key of the returned record is empty.
+func (db *LokalDB) FetchBySeq(bucket string, seq uint64) (ChunkData, error) {
+	return db.FetchBySeqCtx(context.Background(), bucket, seq)
+}
+
+// FetchBySeqCtx is FetchBySeq with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchBySeqCtx(ctx context.Context, bucket string, seq uint64) (kv ChunkData, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		kv, err = tx.FetchBySeq(bucket, seq)
+		return
+	})
+	if err != nil {
+		return ChunkData{}, err
+	}
+	return
+}
+
+// FetchRange gets the records with sequence numbers from fromSeq to toSeq, both included, in ascending order.
+// A toSeq of zero gets the records up to the last one.
+func (db *LokalDB) FetchRange(bucket string, fromSeq uint64, toSeq uint64) ([]ChunkData, error) {
+	return db.FetchRangeCtx(context.Background(), bucket, fromSeq, toSeq)
+}
+
+// FetchRangeCtx is FetchRange with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchRangeCtx(ctx context.Context, bucket string, fromSeq uint64, toSeq uint64) (chunk []ChunkData, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		chunk, err = tx.FetchRange(bucket, fromSeq, toSeq)
+		return
+	})
+	if err != nil {
+		return []ChunkData{}, err
+	}
+	return
+}
+
+// DeleteUpTo removes the records with sequence numbers up to seq, included. It returns the number of records removed.
+// A replayer can checkpoint the sequence number of the last forwarded record and remove everything up to it.
+// Records reserved by a lease that has not expired and records that are not due yet are kept, since they
+// were not delivered with the records around them.
+func (db *LokalDB) DeleteUpTo(bucket string, seq uint64) (int, error) {
+	return db.DeleteUpToCtx(context.Background(), bucket, seq)
+}
+
+// DeleteUpToCtx is DeleteUpTo with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) DeleteUpToCtx(ctx context.Context, bucket string, seq uint64) (n int, err error) {
+	err = db.UpdateCtx(ctx, func(tx *Tx) (err error) {
+		n, err = tx.DeleteUpTo(bucket, seq)
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+	return
+}
+
+// FetchBySeq gets the record with the sequence number. If there is none, the key of the returned record is empty.
+func (tx *Tx) FetchBySeq(bucket string, seq uint64) (ChunkData, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		keyb   []byte
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil || inb == nil {
+		return ChunkData{}, err
+	}
+
+	if keyb = inb.Get([]byte(strconv.FormatUint(seq, 10))); keyb == nil || expired(inb, keyb, tx.now()) {
+		return ChunkData{}, nil
+	}
+
+	return record(b, inb, keyb, int(seq)), nil
+}
+
+// FetchRange gets the records with sequence numbers from fromSeq to toSeq, both included, in ascending order
+func (tx *Tx) FetchRange(bucket string, fromSeq uint64, toSeq uint64) ([]ChunkData, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		chunk  = make([]ChunkData, 0)
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil || inb == nil || fromSeq > math.MaxInt {
+		return chunk, err
+	}
+
+	live(inb, int(fromSeq), true, tx.now(), func(idx int, keyb []byte) bool {
+		if toSeq != 0 && uint64(idx) > toSeq {
+			return false
+		}
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+		chunk = append(chunk, record(b, inb, keyb, idx))
+		return true
+	})
+	if err != nil {
+		return []ChunkData{}, err
+	}
+
+	return chunk, nil
+}
+
+// DeleteUpTo removes the records with sequence numbers up to seq, included, except the reserved and delayed ones.
+// It returns the number of records removed.
+func (tx *Tx) DeleteUpTo(bucket string, seq uint64) (int, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		keys   [][]byte
+	)
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return 0, err
+	}
+
+	now := tx.now()
+	walk(inb, -1, true, func(idx int, keyb []byte) bool {
+		if uint64(idx) > seq {
+			return false
+		}
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+		if leased(inb, keyb, now) || delayed(inb, keyb, now) {
+			return true
+		}
+		keys = append(keys, keyb)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	if err = remove(b, inb, keys...); err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
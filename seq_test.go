@@ -0,0 +1,73 @@
+package lokaldb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSequences(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		chunk []ChunkData
+		kv    ChunkData
+		n     int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 10; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("m%02d", i), []byte(`data`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	// Overwriting a key keeps its sequence number
+	if err = db.Store(`default`, `m03`, []byte(`updated`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+
+	if chunk, err = db.FetchChunkDown(`default`, 3, 0); err != nil {
+		t.Fatalf("fetch chunk down: %s", err)
+	}
+	for i, kv := range chunk {
+		if kv.Seq != uint64(i+1) {
+			t.Fatalf("fetch chunk down: %s has seq %d, want %d", kv.Key, kv.Seq, i+1)
+		}
+	}
+
+	if kv, err = db.FetchBySeq(`default`, 3); err != nil || kv.Key != `m03` || string(kv.Value) != `updated` {
+		t.Fatalf("fetch by seq: got %+v, %v", kv, err)
+	}
+	if kv, err = db.FetchBySeq(`default`, 42); err != nil || kv.Key != `` {
+		t.Fatalf("fetch missing seq: got %+v, %v", kv, err)
+	}
+
+	if chunk, err = db.FetchRange(`default`, 4, 6); err != nil || keysOf(chunk) != `m04 m05 m06 ` {
+		t.Fatalf("fetch range: got %s, %v", keysOf(chunk), err)
+	}
+
+	// Checkpoint after forwarding through seq 7
+	if n, err = db.DeleteUpTo(`default`, 7); err != nil || n != 7 {
+		t.Fatalf("delete up to: got %d, %v", n, err)
+	}
+	if chunk, err = db.FetchRange(`default`, 0, 0); err != nil || keysOf(chunk) != `m08 m09 m10 ` {
+		t.Fatalf("fetch range after delete: got %s, %v", keysOf(chunk), err)
+	}
+
+	// Sequence numbers continue after the bucket is emptied
+	if _, err = db.CutChunkDown(`default`, 0); err != nil {
+		t.Fatalf("cut chunk down: %s", err)
+	}
+	if err = db.Store(`default`, `m11`, []byte(`data`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if chunk, err = db.CutChunkDown(`default`, 0); err != nil || len(chunk) != 1 || chunk[0].Seq != 11 {
+		t.Fatalf("cut chunk down: got %+v, %v", chunk, err)
+	}
+}
@@ -0,0 +1,238 @@
+package lokaldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Size of the chunk records of a value stored with StoreReader
+const streamChunkSize = 256 * 1024
+
+// Name of the bucket inside the internal bucket that keeps the chunk records of big values
+var recChunkBucket []byte = []byte(`CRUCIlsmlHwqxDqMrz4i`)
+
+// StoreReader inserts the data read from the reader in the bucket. It will update records containing the same key.
+//
+// Values bigger than a few hundred kilobytes are split into ordered chunk records kept beside the bucket,
+// so they are not limited by the maximum value size of bbolt. The record still takes a single position
+// in the queue and its chunks are removed with it. Every read returns the whole value; use FetchTo
+// to write it out without holding it in memory.
+func (db *LokalDB) StoreReader(bucket string, key string, r io.Reader) error {
+	return db.StoreReaderCtx(context.Background(), bucket, key, r)
+}
+
+// StoreReaderCtx is StoreReader with a context. It returns the error of the context if it is done before the transaction is committed.
+func (db *LokalDB) StoreReaderCtx(ctx context.Context, bucket string, key string, r io.Reader) error {
+	return db.UpdateCtx(ctx, func(tx *Tx) error {
+		return tx.StoreReader(bucket, key, r)
+	})
+}
+
+// FetchTo writes the value of the record with the provided key to the writer, one chunk at a time.
+// It returns the number of bytes written. If the record does not exist, it returns ErrKeyNotFound.
+func (db *LokalDB) FetchTo(bucket string, key string, w io.Writer) (int64, error) {
+	return db.FetchToCtx(context.Background(), bucket, key, w)
+}
+
+// FetchToCtx is FetchTo with a context. It returns the error of the context if it is done before the transaction is finished.
+func (db *LokalDB) FetchToCtx(ctx context.Context, bucket string, key string, w io.Writer) (n int64, err error) {
+	err = db.ViewCtx(ctx, func(tx *Tx) (err error) {
+		n, err = tx.FetchTo(bucket, key, w)
+		return
+	})
+	return
+}
+
+// StoreReader inserts the data read from the reader in the bucket. Big values are split into chunk records.
+func (tx *Tx) StoreReader(bucket string, key string, r io.Reader) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		cb     *bolt.Bucket
+		n      int
+		seq    uint64
+		keyb   = []byte(key)
+		buf    = make([]byte, streamChunkSize)
+	)
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	ix := tx.indexes(bucket)
+
+	// A value that fits in one chunk is stored as usual
+	if n, err = io.ReadFull(r, buf); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if n < len(buf) {
+		return put(b, inb, keyb, buf[:n], nil, BucketPolicy, ix, tx.now())
+	}
+
+	// The record holds an empty value and its chunks are added after it,
+	// since storing a record removes the chunks of its previous value
+	if err = place(b, inb, keyb, []byte{}, nil, BucketPolicy, tx.now()); err != nil {
+		return err
+	}
+	if cb, err = chunkBucket(inb, keyb, true); err != nil {
+		return err
+	}
+
+	for n > 0 {
+		if err = tx.ctx.Err(); err != nil {
+			return err
+		}
+
+		seq++
+		if err = cb.Put(binary.BigEndian.AppendUint64(nil, seq), bytes.Clone(buf[:n])); err != nil {
+			return err
+		}
+
+		if n, err = io.ReadFull(r, buf); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+
+	return reindex(b, inb, ix, keyb)
+}
+
+// FetchTo writes the value of the record with the provided key to the writer, one chunk at a time
+func (tx *Tx) FetchTo(bucket string, key string, w io.Writer) (int64, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		data   []byte
+		keyb   = []byte(key)
+		cb     *bolt.Bucket
+		total  int64
+		n      int
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil {
+		return 0, err
+	}
+
+	if data = b.Get(keyb); data == nil || expired(inb, keyb, tx.now()) {
+		return 0, ErrKeyNotFound
+	}
+
+	if inb != nil {
+		cb, _ = chunkBucket(inb, keyb, false)
+	}
+	if cb == nil {
+		n, err = w.Write(data)
+		return int64(n), err
+	}
+
+	err = cb.ForEach(func(_, v []byte) error {
+		if err := tx.ctx.Err(); err != nil {
+			return err
+		}
+		n, err := w.Write(v)
+		total += int64(n)
+		return err
+	})
+
+	return total, err
+}
+
+// Store a record with the value of a record of another bucket. The chunk records of a value that was split
+// are copied instead of being joined, so that the value is not limited by the maximum value size of bbolt.
+func putFrom(b, inb *bolt.Bucket, key []byte, sb, sinb *bolt.Bucket, skey []byte, env *Envelope, policy OverwritePolicy, ix []index, now time.Time) error {
+
+	var (
+		err     error
+		cb, scb *bolt.Bucket
+		data    = sb.Get(skey)
+	)
+
+	if len(data) == 0 && sinb != nil {
+		scb, _ = chunkBucket(sinb, skey, false)
+	}
+	if scb == nil {
+		return put(b, inb, key, data, env, policy, ix, now)
+	}
+
+	// Storing a record removes the chunks of its previous value, so they are copied after it
+	if err = place(b, inb, key, []byte{}, env, policy, now); err != nil {
+		return err
+	}
+	if cb, err = chunkBucket(inb, key, true); err != nil {
+		return err
+	}
+	if err = copyBucket(cb, scb); err != nil {
+		return err
+	}
+
+	return reindex(b, inb, ix, key)
+}
+
+// Get a copy of the value of a record that outlives the transaction
+func value(b, inb *bolt.Bucket, key []byte) []byte {
+
+	data, joined := view(b, inb, key)
+	if joined {
+		return data
+	}
+
+	return bytes.Clone(data)
+}
+
+// Get the value of a record, joining its chunks if it was split. Unless it was joined,
+// the value is the memory of the database and is only valid during the transaction.
+func view(b, inb *bolt.Bucket, key []byte) ([]byte, bool) {
+
+	data := b.Get(key)
+	if data == nil || len(data) > 0 || inb == nil {
+		return data, false
+	}
+
+	cb, _ := chunkBucket(inb, key, false)
+	if cb == nil {
+		return data, false
+	}
+
+	var buf bytes.Buffer
+	cb.ForEach(func(_, v []byte) error {
+		buf.Write(v)
+		return nil
+	})
+
+	return buf.Bytes(), true
+}
+
+// Get the bucket with the chunk records of a key. A new empty bucket is created if create is true.
+func chunkBucket(inb *bolt.Bucket, key []byte, create bool) (*bolt.Bucket, error) {
+
+	if !create {
+		if cr := inb.Bucket(recChunkBucket); cr != nil {
+			return cr.Bucket(key), nil
+		}
+		return nil, nil
+	}
+
+	cr, err := inb.CreateBucketIfNotExists(recChunkBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return cr.CreateBucket(key)
+}
+
+// Remove the chunk records of a key
+func dropChunks(inb *bolt.Bucket, key []byte) error {
+
+	if cr := inb.Bucket(recChunkBucket); cr != nil && cr.Bucket(key) != nil {
+		return cr.DeleteBucket(key)
+	}
+
+	return nil
+}
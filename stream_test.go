@@ -0,0 +1,188 @@
+package lokaldb
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreams(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		buf   bytes.Buffer
+		n     int64
+		cnt   int
+		data  []byte
+		chunk []ChunkData
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	big := make([]byte, 3*streamChunkSize+1234)
+	rand.New(rand.NewSource(1)).Read(big)
+
+	// chunks counts the chunk records kept for the key
+	chunks := func(key string) (n int) {
+		db.View(func(tx *Tx) error {
+			_, inb, err := tx.bucket(`uploads`)
+			if err != nil || inb == nil {
+				return err
+			}
+			if cb, _ := chunkBucket(inb, []byte(key), false); cb != nil {
+				n = cb.Stats().KeyN
+			}
+			return nil
+		})
+		return
+	}
+
+	if err = db.Store(`uploads`, `before`, []byte(`small`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if err = db.StoreReader(`uploads`, `file-1`, bytes.NewReader(big)); err != nil {
+		t.Fatalf("store reader: %s", err)
+	}
+	if err = db.StoreReader(`uploads`, `file-2`, bytes.NewReader([]byte(`tiny`))); err != nil {
+		t.Fatalf("store reader small: %s", err)
+	}
+
+	if got := chunks(`file-1`); got != 4 {
+		t.Fatalf("chunks of file-1: got %d, want 4", got)
+	}
+	if got := chunks(`file-2`); got != 0 {
+		t.Fatalf("chunks of file-2: got %d, want 0", got)
+	}
+
+	// A big value still takes a single position
+	if cnt, _ = db.Count(`uploads`); cnt != 3 {
+		t.Fatalf("count: got %d, want 3", cnt)
+	}
+	if chunk, err = db.FetchChunkDown(`uploads`, 0, 0); err != nil || keysOf(chunk) != `before file-1 file-2 ` || chunk[1].Seq != 2 {
+		t.Fatalf("fetch chunk down: got %s, %v", keysOf(chunk), err)
+	}
+	if !bytes.Equal(chunk[1].Value, big) {
+		t.Fatal(`fetch chunk down: value of file-1 differs`)
+	}
+
+	if n, err = db.FetchTo(`uploads`, `file-1`, &buf); err != nil || n != int64(len(big)) || !bytes.Equal(buf.Bytes(), big) {
+		t.Fatalf("fetch to: got %d bytes, %v", n, err)
+	}
+	if data, err = db.Fetch(`uploads`, `file-1`); err != nil || !bytes.Equal(data, big) {
+		t.Fatalf("fetch: got %d bytes, %v", len(data), err)
+	}
+	if _, err = db.FetchTo(`uploads`, `missing`, &buf); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("fetch to missing key: got %v, want %v", err, ErrKeyNotFound)
+	}
+
+	// Storing a small value removes the chunks
+	if err = db.Store(`uploads`, `file-1`, []byte(`replaced`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+	if got := chunks(`file-1`); got != 0 {
+		t.Fatalf("chunks after store: got %d, want 0", got)
+	}
+	if data, _ = db.Fetch(`uploads`, `file-1`); string(data) != `replaced` {
+		t.Fatalf("fetch after store: got %q", data)
+	}
+
+	// Removals take the chunks with the record
+	if err = db.StoreReader(`uploads`, `file-1`, bytes.NewReader(big)); err != nil {
+		t.Fatalf("store reader: %s", err)
+	}
+	if err = db.Delete(`uploads`, `file-1`); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if got := chunks(`file-1`); got != 0 {
+		t.Fatalf("chunks after delete: got %d, want 0", got)
+	}
+
+	if err = db.StoreReader(`uploads`, `file-3`, bytes.NewReader(big)); err != nil {
+		t.Fatalf("store reader: %s", err)
+	}
+	if _, err = db.SliceDown(`uploads`); err != nil {
+		t.Fatalf("slice down: %s", err)
+	}
+	if chunk, err = db.CutChunkDown(`uploads`, 0); err != nil || keysOf(chunk) != `file-2 file-3 ` || !bytes.Equal(chunk[1].Value, big) {
+		t.Fatalf("cut chunk down: got %s, %v", keysOf(chunk), err)
+	}
+	if got := chunks(`file-3`); got != 0 {
+		t.Fatalf("chunks after cut: got %d, want 0", got)
+	}
+}
+
+func TestStreamDeadLetter(t *testing.T) {
+	var (
+		err   error
+		db    *LokalDB
+		buf   bytes.Buffer
+		lease Lease
+		n     int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	big := make([]byte, 3*streamChunkSize+1234)
+	rand.New(rand.NewSource(1)).Read(big)
+
+	// chunks counts the chunk records kept for the key in the bucket
+	chunks := func(bucket, key string) (n int) {
+		db.View(func(tx *Tx) error {
+			_, inb, err := tx.bucket(bucket)
+			if err != nil || inb == nil {
+				return err
+			}
+			if cb, _ := chunkBucket(inb, []byte(key), false); cb != nil {
+				n = cb.Stats().KeyN
+			}
+			return nil
+		})
+		return
+	}
+
+	if err = db.SetDeadLetter(`uploads`, `uploads-dlq`, 0); err != nil {
+		t.Fatalf("set dead letter: %s", err)
+	}
+	if err = db.StoreReader(`uploads`, `file-1`, bytes.NewReader(big)); err != nil {
+		t.Fatalf("store reader: %s", err)
+	}
+	if lease, err = db.Reserve(`uploads`, 1, time.Minute); err != nil || keysOf(lease.Records) != `file-1 ` {
+		t.Fatalf("reserve: got %q %v, want file-1", keysOf(lease.Records), err)
+	}
+	if err = db.Nack(lease.ID); err != nil {
+		t.Fatalf("nack: %s", err)
+	}
+
+	// The chunks move with the record to the dead-letter bucket and back
+	if got := chunks(`uploads-dlq`, `file-1`); got != 4 {
+		t.Fatalf("chunks of dead letter: got %d, want 4", got)
+	}
+	if _, err = db.FetchTo(`uploads-dlq`, `file-1`, &buf); err != nil || !bytes.Equal(buf.Bytes(), big) {
+		t.Fatalf("fetch dead letter: got %d bytes %v, want %d", buf.Len(), err, len(big))
+	}
+
+	if n, err = db.Redrive(`uploads-dlq`, `uploads`, 0); err != nil || n != 1 {
+		t.Fatalf("redrive: got %d %v, want 1", n, err)
+	}
+	if got := chunks(`uploads`, `file-1`); got != 4 {
+		t.Fatalf("chunks of redriven: got %d, want 4", got)
+	}
+	if got := chunks(`uploads-dlq`, `file-1`); got != 0 {
+		t.Fatalf("chunks left in dead letters: got %d, want 0", got)
+	}
+	buf.Reset()
+	if _, err = db.FetchTo(`uploads`, `file-1`, &buf); err != nil || !bytes.Equal(buf.Bytes(), big) {
+		t.Fatalf("fetch redriven: got %d bytes %v, want %d", buf.Len(), err, len(big))
+	}
+}
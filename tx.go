@@ -0,0 +1,500 @@
+package lokaldb
+
+import (
+	"context"
+	"sync/atomic"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Tx is a transaction on the local database. It exposes the same operations as LokalDB
+// so that several of them, even on different buckets, commit or roll back together.
+//
+// A Tx is only valid inside the function passed to Update or View. Values returned
+// by its methods are copies that can be kept after the function returns.
+type Tx struct {
+	tx  *bolt.Tx
+	ctx context.Context
+	db  *LokalDB
+}
+
+// States of a transaction started with a cancellable context
+const (
+	txWaiting int32 = iota
+	txStarted
+	txAbandoned
+)
+
+// Update runs the function in a writable transaction. All operations done with the
+// transaction are committed if the function returns nil, otherwise they are rolled back.
+func (db *LokalDB) Update(fn func(tx *Tx) error) error {
+	return db.UpdateCtx(context.Background(), fn)
+}
+
+// UpdateCtx is Update with a context. If the context is done while waiting for the writer lock,
+// it returns the error of the context without running the function. Operations of the transaction
+// also stop with the error of the context during long loops, rolling back the transaction.
+func (db *LokalDB) UpdateCtx(ctx context.Context, fn func(tx *Tx) error) error {
+
+	if db.ldb == nil {
+		return ErrLocalDatabaseNotYetOpened
+	}
+
+	return db.run(ctx, db.ldb.Update, fn)
+}
+
+// View runs the function in a read-only transaction. Operations that modify data return ErrTxNotWritable.
+func (db *LokalDB) View(fn func(tx *Tx) error) error {
+	return db.ViewCtx(context.Background(), fn)
+}
+
+// ViewCtx is View with a context.
+func (db *LokalDB) ViewCtx(ctx context.Context, fn func(tx *Tx) error) error {
+
+	if db.ldb == nil {
+		return ErrLocalDatabaseNotYetOpened
+	}
+
+	return db.run(ctx, db.ldb.View, fn)
+}
+
+// Batch runs the function in a writable transaction that is group-committed with other concurrent Batch calls.
+// The function could be run more than once if another function in the group fails, so it must be idempotent.
+func (db *LokalDB) Batch(fn func(tx *Tx) error) error {
+	return db.BatchCtx(context.Background(), fn)
+}
+
+// BatchCtx is Batch with a context.
+func (db *LokalDB) BatchCtx(ctx context.Context, fn func(tx *Tx) error) error {
+
+	if db.ldb == nil {
+		return ErrLocalDatabaseNotYetOpened
+	}
+
+	return db.run(ctx, db.ldb.Batch, fn)
+}
+
+// Run the function in a transaction started by begin.
+//
+// bbolt cannot cancel a transaction waiting for its lock, so with a cancellable context the
+// transaction is started in another goroutine. If the context is done before the transaction
+// starts, it is abandoned and rolls back as soon as it gets the lock. Once started, the caller
+// waits for the function to finish so that a commit is never reported as cancelled.
+func (db *LokalDB) run(ctx context.Context, begin func(func(*bolt.Tx) error) error, fn func(tx *Tx) error) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ctx.Done() == nil {
+		return begin(func(btx *bolt.Tx) error {
+			return fn(&Tx{tx: btx, ctx: ctx, db: db})
+		})
+	}
+
+	var state atomic.Int32
+
+	done := make(chan error, 1)
+	go func() {
+		done <- begin(func(btx *bolt.Tx) error {
+			// A batch could run the function again after it started
+			if !state.CompareAndSwap(txWaiting, txStarted) && state.Load() != txStarted {
+				return ctx.Err()
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(&Tx{tx: btx, ctx: ctx, db: db})
+		})
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if state.CompareAndSwap(txWaiting, txAbandoned) {
+			return ctx.Err()
+		}
+		return <-done
+	}
+}
+
+// Context returns the context of the transaction
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// Writable reports whether the transaction can modify data
+func (tx *Tx) Writable() bool {
+	return tx.tx.Writable()
+}
+
+// Store inserts data in the bucket. It will update records containing the same key with the current value.
+func (tx *Tx) Store(bucket string, key string, data []byte) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	return put(b, inb, []byte(key), data, nil, BucketPolicy, tx.indexes(bucket), tx.now())
+}
+
+// StoreOnce inserts data in the bucket in one go. It will update records containing the same key with the current value.
+// The envelopes of the records are stored with them.
+func (tx *Tx) StoreOnce(bucket string, data []ChunkData) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if b, inb, err = tx.create(bucket); err != nil {
+		return err
+	}
+
+	ix := tx.indexes(bucket)
+
+	for _, kv := range data {
+		if err = tx.ctx.Err(); err != nil {
+			return err
+		}
+		if err = put(b, inb, []byte(kv.Key), kv.Value, &kv.Envelope, BucketPolicy, ix, tx.now()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fetch gets a single record from the bucket with the provided key. If the record does not exist, it will return nil.
+func (tx *Tx) Fetch(bucket string, key string) ([]byte, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if b, inb, err = tx.bucket(bucket); err != nil {
+		return nil, err
+	}
+
+	if expired(inb, []byte(key), tx.now()) {
+		return nil, nil
+	}
+
+	return value(b, inb, []byte(key)), nil
+}
+
+// Delete a single record in the bucket that matches the provided key.
+func (tx *Tx) Delete(bucket string, key string) error {
+	return tx.DeleteOnce(bucket, []string{key})
+}
+
+// DeleteOnce remove records in the bucket in one go from a supplied provided key.
+func (tx *Tx) DeleteOnce(bucket string, key []string) error {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if len(key) == 0 {
+		return ErrNoKeysSet
+	}
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return err
+	}
+
+	keys := make([][]byte, 0, len(key))
+	for _, k := range key {
+		keys = append(keys, []byte(k))
+	}
+
+	return remove(b, inb, keys...)
+}
+
+// FetchChunkUp gets a chunk of data starting from the bottom to top limited by max.
+// The offset is the number of records skipped from the bottom.
+func (tx *Tx) FetchChunkUp(bucket string, max int, offset int) ([]ChunkData, error) {
+	return tx.fetchChunk(bucket, max, offset, false)
+}
+
+// FetchChunkDown gets a chunk of data starting from the top to bottom limited by max.
+// The offset is the number of records skipped from the top.
+func (tx *Tx) FetchChunkDown(bucket string, max int, offset int) ([]ChunkData, error) {
+	return tx.fetchChunk(bucket, max, offset, true)
+}
+
+// Get a chunk of data limited by max after skipping offset records
+func (tx *Tx) fetchChunk(bucket string, max int, offset int, forward bool) ([]ChunkData, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+	)
+
+	if max < 0 {
+		return []ChunkData{}, ErrInvalidLimit
+	}
+
+	if b, inb, err = tx.bucket(bucket); err != nil {
+		return []ChunkData{}, err
+	}
+
+	// A bucket without an internal bucket has no records yet.
+	if inb == nil {
+		return []ChunkData{}, nil
+	}
+
+	if inb.Get(recFirstIdxKey) == nil || inb.Get(recLastIdxKey) == nil {
+		return []ChunkData{}, ErrCorruptedInternalBucket
+	}
+
+	chunk := make([]ChunkData, 0)
+
+	// Loop from first or last until count is over the maximum
+	ready(inb, -1, forward, tx.now(), func(idx int, keyb []byte) bool {
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+		if offset > 0 {
+			offset--
+			return true
+		}
+		chunk = append(chunk, record(b, inb, keyb, idx))
+		return max == 0 || len(chunk) < max
+	})
+	if err != nil {
+		return []ChunkData{}, err
+	}
+
+	return chunk, nil
+}
+
+// FetchDelete gets the record with the provided key and deletes it.
+func (tx *Tx) FetchDelete(bucket string, key string) ([]byte, error) {
+
+	var (
+		err        error
+		b, inb     *bolt.Bucket
+		keyb, data []byte
+	)
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return nil, err
+	}
+
+	keyb = []byte(key)
+	if !expired(inb, keyb, tx.now()) {
+		data = value(b, inb, keyb)
+	}
+
+	if err = remove(b, inb, keyb); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// SliceUp fetches and deletes a record from bottom to top.
+func (tx *Tx) SliceUp(bucket string) ([]byte, error) {
+	kv, err := tx.slice(bucket, false)
+	return kv.Value, err
+}
+
+// SliceDown fetches and deletes a record from top to bottom.
+func (tx *Tx) SliceDown(bucket string) ([]byte, error) {
+	kv, err := tx.slice(bucket, true)
+	return kv.Value, err
+}
+
+// Fetch and delete the first or last record. If there is none, the key of the returned record is empty.
+func (tx *Tx) slice(bucket string, forward bool) (ChunkData, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		idx    int
+		keyb   []byte
+		kv     ChunkData
+	)
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return ChunkData{}, err
+	}
+
+	// get the first or last record that is not reserved by a lease
+	if idx, keyb = next(inb, forward, tx.now()); keyb == nil {
+		return ChunkData{}, nil
+	}
+
+	kv = record(b, inb, keyb, idx)
+
+	if err = remove(b, inb, keyb); err != nil {
+		return ChunkData{}, err
+	}
+
+	return kv, nil
+}
+
+// CutChunkUp gets a chunk of data starting from bottom to top in descending order and removes them.
+func (tx *Tx) CutChunkUp(bucket string, max int) ([]ChunkData, error) {
+
+	chunk, err := tx.cutChunk(bucket, max, false)
+	if err != nil || len(chunk) == 0 {
+		return []ChunkData{}, err
+	}
+
+	return chunk, nil
+}
+
+// CutChunkDown gets a chunk of data starting from top to bottom in ascending order and removes them.
+func (tx *Tx) CutChunkDown(bucket string, max int) ([]ChunkData, error) {
+
+	chunk, err := tx.cutChunk(bucket, max, true)
+	if err != nil {
+		return []ChunkData{}, err
+	}
+
+	return chunk, nil
+}
+
+// Get a chunk of data limited by max and remove them. It returns nil if there are no records.
+func (tx *Tx) cutChunk(bucket string, max int, forward bool) ([]ChunkData, error) {
+
+	var (
+		err    error
+		b, inb *bolt.Bucket
+		chunk  []ChunkData
+		keys   [][]byte
+	)
+
+	if max < 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	if b, inb, err = tx.writable(bucket); err != nil || inb == nil {
+		return nil, err
+	}
+
+	// Loop from first or last until count is over the maximum
+	ready(inb, -1, forward, tx.now(), func(idx int, keyb []byte) bool {
+		if err = tx.ctx.Err(); err != nil {
+			return false
+		}
+		chunk = append(chunk, record(b, inb, keyb, idx))
+		keys = append(keys, keyb)
+		return max == 0 || len(chunk) < max
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// if no records fetched, exit
+	if len(chunk) == 0 {
+		return nil, nil
+	}
+
+	if err = remove(b, inb, keys...); err != nil {
+		return nil, err
+	}
+
+	return chunk, nil
+}
+
+// Count records in the bucket
+func (tx *Tx) Count(bucket string) (int, error) {
+
+	var (
+		err error
+		inb *bolt.Bucket
+	)
+
+	if _, inb, err = tx.bucket(bucket); err != nil {
+		return 0, err
+	}
+
+	// A bucket without an internal bucket has no records yet.
+	if inb == nil {
+		return 0, nil
+	}
+
+	return getint(inb, recCntKey), nil
+}
+
+// Get the bucket and its internal bucket. The internal bucket is nil if the bucket has no records yet.
+func (tx *Tx) bucket(bucket string) (b, inb *bolt.Bucket, err error) {
+
+	var (
+		c    container
+		name []byte
+	)
+
+	if c, name, err = tx.parent(bucket, false); err != nil {
+		return nil, nil, err
+	}
+
+	if b = c.Bucket(name); b == nil {
+		return nil, nil, ErrBucketDoesNotExist
+	}
+
+	inb = c.Bucket(inname(name))
+
+	return b, inb, nil
+}
+
+// Get the bucket and its internal bucket for modification
+func (tx *Tx) writable(bucket string) (b, inb *bolt.Bucket, err error) {
+
+	if !tx.tx.Writable() {
+		return nil, nil, ErrTxNotWritable
+	}
+
+	return tx.bucket(bucket)
+}
+
+// Get the bucket and its internal bucket. Both are created if they do not exist,
+// as well as the parent buckets in its path. A new internal bucket gets the first and last
+// indexes of an empty bucket, so that it can be read before a record is stored in it.
+func (tx *Tx) create(bucket string) (b, inb *bolt.Bucket, err error) {
+
+	var (
+		c    container
+		name []byte
+	)
+
+	if !tx.tx.Writable() {
+		return nil, nil, ErrTxNotWritable
+	}
+
+	if c, name, err = tx.parent(bucket, true); err != nil {
+		return nil, nil, err
+	}
+
+	if b, err = c.CreateBucketIfNotExists(name); err != nil {
+		return nil, nil, err
+	}
+
+	if inb, err = c.CreateBucketIfNotExists(inname(name)); err != nil {
+		return nil, nil, err
+	}
+
+	if inb.Get(recFirstIdxKey) == nil {
+		if err = putint(inb, recFirstIdxKey, 1); err != nil {
+			return nil, nil, err
+		}
+	}
+	if inb.Get(recLastIdxKey) == nil {
+		if err = putint(inb, recLastIdxKey, 0); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return b, inb, nil
+}
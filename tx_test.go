@@ -0,0 +1,265 @@
+package lokaldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdateAcrossBuckets(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		cnt int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		if err = db.Store(`outbound`, fmt.Sprintf("msg-%03d", i), []byte(fmt.Sprintf("%d", i))); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	// Move 50 records from outbound to inflight
+	err = db.Update(func(tx *Tx) error {
+		chunk, err := tx.CutChunkDown(`outbound`, 50)
+		if err != nil {
+			return err
+		}
+		return tx.StoreOnce(`inflight`, chunk)
+	})
+	if err != nil {
+		t.Fatalf("update: %s", err)
+	}
+
+	if cnt, _ = db.Count(`outbound`); cnt != 50 {
+		t.Fatalf("outbound count: got %d, want 50", cnt)
+	}
+	if cnt, _ = db.Count(`inflight`); cnt != 50 {
+		t.Fatalf("inflight count: got %d, want 50", cnt)
+	}
+
+	// A failing callback rolls back every operation
+	errAbort := errors.New(`abort`)
+	err = db.Update(func(tx *Tx) error {
+		chunk, err := tx.CutChunkDown(`outbound`, 50)
+		if err != nil {
+			return err
+		}
+		if err = tx.StoreOnce(`inflight`, chunk); err != nil {
+			return err
+		}
+		if err = tx.Store(`audit`, `moved`, []byte(`50`)); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("update: got %v, want %v", err, errAbort)
+	}
+
+	if cnt, _ = db.Count(`outbound`); cnt != 50 {
+		t.Fatalf("outbound count after rollback: got %d, want 50", cnt)
+	}
+	if cnt, _ = db.Count(`inflight`); cnt != 50 {
+		t.Fatalf("inflight count after rollback: got %d, want 50", cnt)
+	}
+	if _, err = db.Count(`audit`); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("audit bucket after rollback: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+
+	// The index of the moved records is kept in sync
+	chunk, err := db.FetchChunkDown(`inflight`, 1, 0)
+	if err != nil || len(chunk) != 1 || chunk[0].Key != `msg-000` {
+		t.Fatalf("inflight head: got %v, %v", chunk, err)
+	}
+	chunk, err = db.FetchChunkDown(`outbound`, 1, 0)
+	if err != nil || len(chunk) != 1 || chunk[0].Key != `msg-050` {
+		t.Fatalf("outbound head: got %v, %v", chunk, err)
+	}
+}
+
+func TestViewNotWritable(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	if err = db.Store(`default`, `name`, []byte(`George`)); err != nil {
+		t.Fatalf("store: %s", err)
+	}
+
+	err = db.View(func(tx *Tx) error {
+		data, err := tx.Fetch(`default`, `name`)
+		if err != nil {
+			return err
+		}
+		if string(data) != `George` {
+			return fmt.Errorf("fetch: got %q, want %q", data, `George`)
+		}
+		if _, err = tx.SliceDown(`default`); !errors.Is(err, ErrTxNotWritable) {
+			return fmt.Errorf("slice down: got %v, want %v", err, ErrTxNotWritable)
+		}
+		if err = tx.Store(`default`, `name`, []byte(`Ringo`)); !errors.Is(err, ErrTxNotWritable) {
+			return fmt.Errorf("store: got %v, want %v", err, ErrTxNotWritable)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreOnceAtomic(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		cnt int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	kv := []ChunkData{
+		{Key: `beatle1`, Value: []byte(`John`)},
+		{Key: `beatle2`, Value: []byte(`Paul`)},
+		{Key: ``, Value: []byte(`Pete`)},
+		{Key: `beatle4`, Value: []byte(`Ringo`)},
+	}
+
+	// The empty key fails the whole batch
+	if err = db.StoreOnce(`default`, kv); err == nil {
+		t.Fatal(`store once: expected an error for an empty key`)
+	}
+	if _, err = db.Count(`default`); !errors.Is(err, ErrBucketDoesNotExist) {
+		t.Fatalf("count after failed batch: got %v, want %v", err, ErrBucketDoesNotExist)
+	}
+
+	kv[2].Key = `beatle3`
+	if err = db.StoreOnce(`default`, kv); err != nil {
+		t.Fatalf("store once: %s", err)
+	}
+	if cnt, _ = db.Count(`default`); cnt != 4 {
+		t.Fatalf("count: got %d, want 4", cnt)
+	}
+}
+
+func TestStoreBatch(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		cnt int
+		wg  sync.WaitGroup
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`), WithMaxBatchDelay(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	errs := make(chan error, 200)
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				errs <- db.StoreBatch(`default`, fmt.Sprintf("%02d-%02d", g, i), []byte(`data`))
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err = range errs {
+		if err != nil {
+			t.Fatalf("store batch: %s", err)
+		}
+	}
+
+	if cnt, _ = db.Count(`default`); cnt != 200 {
+		t.Fatalf("count: got %d, want 200", cnt)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	var (
+		err error
+		db  *LokalDB
+		cnt int
+	)
+
+	db, err = Open(filepath.Join(t.TempDir(), `test.db`))
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		if err = db.Store(`default`, fmt.Sprintf("msg-%03d", i), []byte(`data`)); err != nil {
+			t.Fatalf("store: %s", err)
+		}
+	}
+
+	// A context done before the call does not start a transaction
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = db.StoreCtx(ctx, `default`, `late`, []byte(`data`)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("store: got %v, want %v", err, context.Canceled)
+	}
+
+	// A store waiting for the writer lock gives up when its context is done
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go db.Update(func(tx *Tx) error {
+		close(locked)
+		<-release
+		return nil
+	})
+	<-locked
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err = db.StoreCtx(ctx, `default`, `waiting`, []byte(`data`)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("store waiting for lock: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+
+	// A context done in the middle of a cut rolls it back
+	ctx, cancel = context.WithCancel(context.Background())
+	err = db.UpdateCtx(ctx, func(tx *Tx) error {
+		cancel()
+		_, err := tx.CutChunkDown(`default`, 0)
+		return err
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("cut chunk down: got %v, want %v", err, context.Canceled)
+	}
+
+	if cnt, _ = db.Count(`default`); cnt != 10 {
+		t.Fatalf("count: got %d, want 10", cnt)
+	}
+	for _, key := range []string{`late`, `waiting`} {
+		if b, _ := db.Fetch(`default`, key); b != nil {
+			t.Fatalf("fetch %s: cancelled store was committed", key)
+		}
+	}
+}